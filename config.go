@@ -0,0 +1,638 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coinbase/rosetta-sdk-go/server"
+	logging "github.com/ipfs/go-log"
+	srv "github.com/zondax/rosetta-filecoin-proxy/rosetta/services"
+	"github.com/zondax/rosetta-filecoin-proxy/rosetta/tools"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	ActorsDBBackendMemory = "memory"
+	ActorsDBBackendDisk   = "disk"
+	ActorsDBBackendLRU    = "lru"
+
+	// ConfigFileEnvName is the env var holding the config file path, when --config isn't set
+	ConfigFileEnvName = "ROSETTA_CONFIG_FILE"
+
+	redactedValue = "<redacted>"
+)
+
+// Config holds the settings of the proxy. They're taken, in increasing priority,
+// from the defaults, the config file, the env vars and the command line flags.
+type Config struct {
+	Server   ServerConfig   `yaml:"server"`
+	Log      LogConfig      `yaml:"log"`
+	Lotus    LotusConfig    `yaml:"lotus"`
+	ActorsDB ActorsDBConfig `yaml:"actorsDB"`
+	Block    BlockConfig    `yaml:"block"`
+	SafeHead SafeHeadConfig `yaml:"safeHead"`
+	Tokens   []TokenConfig  `yaml:"tokens"`
+	Features FeaturesConfig `yaml:"features"`
+}
+
+type ServerConfig struct {
+	ListenAddress string     `yaml:"listenAddress"`
+	Port          int        `yaml:"port"`
+	CORS          CORSConfig `yaml:"cors"`
+}
+
+type CORSConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// "*" allows any origin
+	AllowedOrigins []string `yaml:"allowedOrigins"`
+}
+
+type LogConfig struct {
+	Level string `yaml:"level"`
+}
+
+type LotusConfig struct {
+	URL   string      `yaml:"url"`
+	Token string      `yaml:"token"`
+	Retry RetryConfig `yaml:"retry"`
+	// Timeout of Lotus calls, for the endpoints not in EndpointTimeouts
+	Timeout time.Duration `yaml:"timeout"`
+	// Timeout of Lotus calls by endpoint path, e.g. "/block"
+	EndpointTimeouts map[string]time.Duration `yaml:"endpointTimeouts"`
+}
+
+// RetryConfig sets how the connection to Lotus is retried on startup
+type RetryConfig struct {
+	Attempts int           `yaml:"attempts"`
+	Interval time.Duration `yaml:"interval"`
+}
+
+type ActorsDBConfig struct {
+	// One of "memory", "disk" or "lru"
+	Backend string `yaml:"backend"`
+	// Only used by the "disk" backend
+	Path string `yaml:"path"`
+	// Only used by the "lru" backend
+	Capacity    int           `yaml:"capacity"`
+	NegativeTTL time.Duration `yaml:"negativeTTL"`
+}
+
+type BlockConfig struct {
+	// Source of the transactions' traces: "auto", "StateCompute", "StateReplay" or "ParentReceipts"
+	TraceSource string           `yaml:"traceSource"`
+	Prefetch    PrefetchConfig   `yaml:"prefetch"`
+	StateCache  StateCacheConfig `yaml:"stateCache"`
+	HashIndex   HashIndexConfig  `yaml:"hashIndex"`
+}
+
+// HashIndexConfig sets how the hashes of tipsets are indexed, to serve blocks requested by hash only
+type HashIndexConfig struct {
+	// Tipsets kept by the index, 0 disables it
+	Capacity int `yaml:"capacity"`
+	// Epochs below the chain's head indexed in the background, 0 disables the backfill
+	BackfillDepth int `yaml:"backfillDepth"`
+	// Time between backfills following the chain's head
+	BackfillInterval time.Duration `yaml:"backfillInterval"`
+}
+
+// StateCacheConfig sets how the StateCompute outputs of final tipsets are cached
+type StateCacheConfig struct {
+	// Memory taken by the cached outputs, 0 disables the cache
+	MemoryMB int `yaml:"memoryMB"`
+	// Path of the on-disk database the outputs evicted from memory are spilled to, if set
+	SpillPath string `yaml:"spillPath"`
+	// Disk space taken by the spilled outputs
+	DiskMB int `yaml:"diskMB"`
+	// Epochs below the chain's head a tipset must be to cache its output
+	FinalityDepth int `yaml:"finalityDepth"`
+}
+
+// PrefetchConfig sets how many blocks are computed in the background after a /block request
+type PrefetchConfig struct {
+	// Blocks computed ahead of the requested one, 0 disables prefetching
+	Depth int `yaml:"depth"`
+	// Max number of blocks computed at the same time
+	Concurrency int `yaml:"concurrency"`
+}
+
+// SafeHeadConfig sets which tipset is served as the chain's head, so clients following
+// the tip never see tipsets reverted by a reorg
+type SafeHeadConfig struct {
+	// One of "off", "depth" or "finalized"
+	Mode string `yaml:"mode"`
+	// Epochs below the chain's head the safe head is, only used by the "depth" mode
+	Depth int `yaml:"depth"`
+}
+
+// TokenConfig is an ERC-20 token whose transfers are reported as operations in its own currency
+type TokenConfig struct {
+	// Address of the token's contract, as an Ethereum address (0x...) or an f410 or ID address
+	Address  string `yaml:"address"`
+	Symbol   string `yaml:"symbol"`
+	Decimals int32  `yaml:"decimals"`
+}
+
+type FeaturesConfig struct {
+	// Serve the construction endpoints only, without a Lotus node
+	OfflineMode bool `yaml:"offlineMode"`
+	// Network served in offline mode
+	NetworkName string `yaml:"networkName"`
+	// Serve /metrics/actors-db
+	Metrics bool `yaml:"metrics"`
+}
+
+func defaultConfig() *Config {
+	port, _ := strconv.Atoi(srv.RosettaServerPort)
+	retryAttempts, _ := strconv.Atoi(srv.RetryConnectAttempts)
+
+	return &Config{
+		Server: ServerConfig{
+			Port: port,
+			CORS: CORSConfig{
+				Enabled:        true,
+				AllowedOrigins: []string{"*"},
+			},
+		},
+		Log: LogConfig{
+			Level: "info",
+		},
+		Lotus: LotusConfig{
+			Retry: RetryConfig{
+				Attempts: retryAttempts,
+				Interval: 5 * time.Second,
+			},
+			Timeout:          srv.DefaultLotusCallTimeOut,
+			EndpointTimeouts: map[string]time.Duration{},
+		},
+		ActorsDB: ActorsDBConfig{
+			Backend:     ActorsDBBackendMemory,
+			Path:        srv.DefaultActorsDBPath,
+			Capacity:    tools.DefaultCacheCapacity,
+			NegativeTTL: tools.DefaultNegativeCacheTTL,
+		},
+		Block: BlockConfig{
+			TraceSource: srv.TraceSourceAuto,
+			Prefetch: PrefetchConfig{
+				Concurrency: srv.DefaultBlockPrefetchConcurrency,
+			},
+			StateCache: StateCacheConfig{
+				MemoryMB:      tools.DefaultStateCacheMemoryMB,
+				DiskMB:        tools.DefaultStateCacheDiskMB,
+				FinalityDepth: srv.DefaultStateCacheFinalityDepth,
+			},
+			HashIndex: HashIndexConfig{
+				Capacity:         srv.DefaultBlockHashIndexCapacity,
+				BackfillDepth:    srv.DefaultBlockHashIndexBackfillDepth,
+				BackfillInterval: srv.DefaultBlockHashIndexBackfillInterval,
+			},
+		},
+		SafeHead: SafeHeadConfig{
+			Mode: srv.SafeHeadModeOff,
+		},
+		Features: FeaturesConfig{
+			Metrics: true,
+		},
+	}
+}
+
+// loadConfig builds the configuration from the command line args and the environment.
+// printConfig reports whether --print-config was set.
+func loadConfig(args []string, getenv func(string) string) (cfg *Config, printConfig bool, err error) {
+	cfg = defaultConfig()
+
+	var configFile string
+	fs := flag.NewFlagSet("rosetta-filecoin-proxy", flag.ContinueOnError)
+	fs.StringVar(&configFile, "config", getenv(ConfigFileEnvName), "path of the YAML config file")
+	fs.BoolVar(&printConfig, "print-config", false, "print the resulting configuration and exit")
+	cfg.bindFlags(fs)
+	if err = fs.Parse(args); err != nil {
+		return nil, false, err
+	}
+
+	// Flags override the config file and the env vars,
+	// so they're applied again once those are loaded
+	setFlags := map[string]string{}
+	fs.Visit(func(f *flag.Flag) {
+		setFlags[f.Name] = f.Value.String()
+	})
+
+	cfg = defaultConfig()
+	if configFile != "" {
+		if err = cfg.loadFile(configFile); err != nil {
+			return nil, false, err
+		}
+	}
+
+	if err = cfg.loadEnv(getenv); err != nil {
+		return nil, false, err
+	}
+
+	fs = flag.NewFlagSet("rosetta-filecoin-proxy", flag.ContinueOnError)
+	cfg.bindFlags(fs)
+	for name, value := range setFlags {
+		if fs.Lookup(name) == nil {
+			continue
+		}
+		if err = fs.Set(name, value); err != nil {
+			return nil, false, fmt.Errorf("invalid value '%s' for flag --%s: %w", value, name, err)
+		}
+	}
+
+	if err = cfg.Validate(); err != nil {
+		return nil, false, err
+	}
+
+	return cfg, printConfig, nil
+}
+
+func (cfg *Config) bindFlags(fs *flag.FlagSet) {
+	fs.StringVar(&cfg.Server.ListenAddress, "listen-address", cfg.Server.ListenAddress, "address to listen on (all interfaces if empty)")
+	fs.IntVar(&cfg.Server.Port, "port", cfg.Server.Port, "port to listen on")
+	fs.BoolVar(&cfg.Server.CORS.Enabled, "cors", cfg.Server.CORS.Enabled, "answer CORS requests")
+	fs.Var((*stringList)(&cfg.Server.CORS.AllowedOrigins), "cors-allowed-origins", "comma separated list of allowed CORS origins, \"*\" allows any")
+	fs.StringVar(&cfg.Log.Level, "log-level", cfg.Log.Level, "log level (debug, info, warn, error)")
+	fs.StringVar(&cfg.Lotus.URL, "lotus-url", cfg.Lotus.URL, "Lotus RPC url")
+	fs.StringVar(&cfg.Lotus.Token, "lotus-token", cfg.Lotus.Token, "Lotus RPC token")
+	fs.IntVar(&cfg.Lotus.Retry.Attempts, "lotus-retry-attempts", cfg.Lotus.Retry.Attempts, "attempts to connect to Lotus on startup")
+	fs.DurationVar(&cfg.Lotus.Retry.Interval, "lotus-retry-interval", cfg.Lotus.Retry.Interval, "time between attempts to connect to Lotus")
+	fs.DurationVar(&cfg.Lotus.Timeout, "lotus-timeout", cfg.Lotus.Timeout, "timeout of Lotus calls")
+	fs.StringVar(&cfg.ActorsDB.Backend, "actors-db-backend", cfg.ActorsDB.Backend, "actors database backend (memory, disk, lru)")
+	fs.StringVar(&cfg.ActorsDB.Path, "actors-db-path", cfg.ActorsDB.Path, "path of the on-disk actors database")
+	fs.IntVar(&cfg.ActorsDB.Capacity, "actors-db-capacity", cfg.ActorsDB.Capacity, "entries kept by the lru actors database")
+	fs.DurationVar(&cfg.ActorsDB.NegativeTTL, "actors-db-negative-ttl", cfg.ActorsDB.NegativeTTL, "time missing actors are remembered")
+	fs.StringVar(&cfg.Block.TraceSource, "block-trace-source", cfg.Block.TraceSource, "source of the transactions' traces (auto, StateCompute, StateReplay, ParentReceipts)")
+	fs.IntVar(&cfg.Block.Prefetch.Depth, "block-prefetch-depth", cfg.Block.Prefetch.Depth, "blocks computed ahead of the requested one (0 disables prefetching)")
+	fs.IntVar(&cfg.Block.Prefetch.Concurrency, "block-prefetch-concurrency", cfg.Block.Prefetch.Concurrency, "max blocks prefetched at the same time")
+	fs.IntVar(&cfg.Block.StateCache.MemoryMB, "block-state-cache-memory-mb", cfg.Block.StateCache.MemoryMB, "memory taken by cached StateCompute outputs in MB (0 disables the cache)")
+	fs.StringVar(&cfg.Block.StateCache.SpillPath, "block-state-cache-spill-path", cfg.Block.StateCache.SpillPath, "path of the on-disk database StateCompute outputs are spilled to")
+	fs.IntVar(&cfg.Block.StateCache.DiskMB, "block-state-cache-disk-mb", cfg.Block.StateCache.DiskMB, "disk space taken by spilled StateCompute outputs in MB")
+	fs.IntVar(&cfg.Block.StateCache.FinalityDepth, "block-state-cache-finality-depth", cfg.Block.StateCache.FinalityDepth, "epochs below head a tipset must be to cache its StateCompute output")
+	fs.IntVar(&cfg.Block.HashIndex.Capacity, "block-hash-index-capacity", cfg.Block.HashIndex.Capacity, "tipsets kept by the block hash index (0 disables it)")
+	fs.IntVar(&cfg.Block.HashIndex.BackfillDepth, "block-hash-index-backfill-depth", cfg.Block.HashIndex.BackfillDepth, "epochs below head indexed in the background (0 disables the backfill)")
+	fs.DurationVar(&cfg.Block.HashIndex.BackfillInterval, "block-hash-index-backfill-interval", cfg.Block.HashIndex.BackfillInterval, "time between backfills of the block hash index")
+	fs.StringVar(&cfg.SafeHead.Mode, "safe-head-mode", cfg.SafeHead.Mode, "tipset served as the chain's head (off, depth, finalized)")
+	fs.IntVar(&cfg.SafeHead.Depth, "safe-head-depth", cfg.SafeHead.Depth, "epochs below the chain's head the safe head is, in depth mode")
+	fs.Var((*tokenList)(&cfg.Tokens), "tokens", "comma separated list of ERC-20 tokens to report, as address:symbol:decimals")
+	fs.BoolVar(&cfg.Features.OfflineMode, "offline", cfg.Features.OfflineMode, "run without a Lotus node")
+	fs.StringVar(&cfg.Features.NetworkName, "network-name", cfg.Features.NetworkName, "network served in offline mode")
+	fs.BoolVar(&cfg.Features.Metrics, "metrics", cfg.Features.Metrics, "serve /metrics/actors-db")
+}
+
+func (cfg *Config) loadFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("could not read config file: %w", err)
+	}
+	defer file.Close()
+
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+	if err = decoder.Decode(cfg); err != nil {
+		return fmt.Errorf("could not parse config file '%s': %w", path, err)
+	}
+
+	return nil
+}
+
+func (cfg *Config) loadEnv(getenv func(string) string) error {
+	setters := map[string]func(string) error{
+		"ROSETTA_LISTEN_ADDRESS":             setString(&cfg.Server.ListenAddress),
+		"ROSETTA_PORT":                       setInt(&cfg.Server.Port),
+		"ROSETTA_CORS_ENABLED":               setBool(&cfg.Server.CORS.Enabled),
+		"ROSETTA_CORS_ORIGINS":               (*stringList)(&cfg.Server.CORS.AllowedOrigins).Set,
+		"ROSETTA_LOG_LEVEL":                  setString(&cfg.Log.Level),
+		"LOTUS_RPC_URL":                      setString(&cfg.Lotus.URL),
+		"LOTUS_RPC_TOKEN":                    setString(&cfg.Lotus.Token),
+		"LOTUS_RPC_RETRY_ATTEMPTS":           setInt(&cfg.Lotus.Retry.Attempts),
+		"LOTUS_RPC_RETRY_INTERVAL":           setDuration(&cfg.Lotus.Retry.Interval),
+		srv.LotusCallTimeOutEnvName:          setDuration(&cfg.Lotus.Timeout),
+		"ACTORS_DB_BACKEND":                  setString(&cfg.ActorsDB.Backend),
+		"ACTORS_DB_PATH":                     setString(&cfg.ActorsDB.Path),
+		"ACTORS_DB_CAPACITY":                 setInt(&cfg.ActorsDB.Capacity),
+		"ACTORS_DB_NEGATIVE_TTL":             setDuration(&cfg.ActorsDB.NegativeTTL),
+		"BLOCK_TRACE_SOURCE":                 setString(&cfg.Block.TraceSource),
+		"BLOCK_PREFETCH_DEPTH":               setInt(&cfg.Block.Prefetch.Depth),
+		"BLOCK_PREFETCH_CONCURRENCY":         setInt(&cfg.Block.Prefetch.Concurrency),
+		"BLOCK_STATE_CACHE_MEMORY_MB":        setInt(&cfg.Block.StateCache.MemoryMB),
+		"BLOCK_STATE_CACHE_SPILL_PATH":       setString(&cfg.Block.StateCache.SpillPath),
+		"BLOCK_STATE_CACHE_DISK_MB":          setInt(&cfg.Block.StateCache.DiskMB),
+		"BLOCK_STATE_CACHE_FINALITY_DEPTH":   setInt(&cfg.Block.StateCache.FinalityDepth),
+		"BLOCK_HASH_INDEX_CAPACITY":          setInt(&cfg.Block.HashIndex.Capacity),
+		"BLOCK_HASH_INDEX_BACKFILL_DEPTH":    setInt(&cfg.Block.HashIndex.BackfillDepth),
+		"BLOCK_HASH_INDEX_BACKFILL_INTERVAL": setDuration(&cfg.Block.HashIndex.BackfillInterval),
+		"SAFE_HEAD_MODE":                     setString(&cfg.SafeHead.Mode),
+		"SAFE_HEAD_DEPTH":                    setInt(&cfg.SafeHead.Depth),
+		"TOKENS":                             (*tokenList)(&cfg.Tokens).Set,
+		"ROSETTA_OFFLINE_MODE":               setBool(&cfg.Features.OfflineMode),
+		"ROSETTA_NETWORK_NAME":               setString(&cfg.Features.NetworkName),
+		"ROSETTA_METRICS_ENABLED":            setBool(&cfg.Features.Metrics),
+	}
+
+	for _, endpoint := range srv.LotusEndpoints {
+		endpoint := endpoint
+		setters[srv.LotusCallTimeOutEnvNameFor(endpoint)] = func(value string) error {
+			timeout, err := time.ParseDuration(value)
+			if err != nil {
+				return err
+			}
+			if cfg.Lotus.EndpointTimeouts == nil {
+				cfg.Lotus.EndpointTimeouts = map[string]time.Duration{}
+			}
+			cfg.Lotus.EndpointTimeouts[endpoint] = timeout
+			return nil
+		}
+	}
+
+	for envName, set := range setters {
+		value := getenv(envName)
+		if value == "" {
+			continue
+		}
+		if err := set(value); err != nil {
+			return fmt.Errorf("invalid value '%s' for %s: %w", value, envName, err)
+		}
+	}
+
+	return nil
+}
+
+// Validate checks that the configuration is consistent
+func (cfg *Config) Validate() error {
+	var errs []error
+
+	if cfg.Server.Port <= 0 || cfg.Server.Port > 65535 {
+		errs = append(errs, fmt.Errorf("server.port must be between 1 and 65535, got %d", cfg.Server.Port))
+	}
+	if cfg.Server.CORS.Enabled && len(cfg.Server.CORS.AllowedOrigins) == 0 {
+		errs = append(errs, errors.New("server.cors.allowedOrigins can't be empty when CORS is enabled"))
+	}
+	if _, err := logging.LevelFromString(cfg.Log.Level); err != nil {
+		errs = append(errs, fmt.Errorf("log.level '%s' is not valid", cfg.Log.Level))
+	}
+
+	if cfg.Features.OfflineMode {
+		if cfg.Features.NetworkName == "" {
+			errs = append(errs, errors.New("features.networkName must be set in offline mode"))
+		}
+	} else {
+		if cfg.Lotus.URL == "" {
+			errs = append(errs, errors.New("lotus.url must be set"))
+		}
+		if cfg.Lotus.Retry.Attempts < 1 {
+			errs = append(errs, fmt.Errorf("lotus.retry.attempts must be at least 1, got %d", cfg.Lotus.Retry.Attempts))
+		}
+		if cfg.Lotus.Retry.Interval < 0 {
+			errs = append(errs, errors.New("lotus.retry.interval can't be negative"))
+		}
+	}
+
+	if cfg.Lotus.Timeout <= 0 {
+		errs = append(errs, errors.New("lotus.timeout must be positive"))
+	}
+	for endpoint, timeout := range cfg.Lotus.EndpointTimeouts {
+		if !isLotusEndpoint(endpoint) {
+			errs = append(errs, fmt.Errorf("lotus.endpointTimeouts: unknown endpoint '%s'", endpoint))
+		}
+		if timeout <= 0 {
+			errs = append(errs, fmt.Errorf("lotus.endpointTimeouts: timeout of '%s' must be positive", endpoint))
+		}
+	}
+
+	switch cfg.ActorsDB.Backend {
+	case ActorsDBBackendMemory:
+	case ActorsDBBackendDisk:
+		if cfg.ActorsDB.Path == "" {
+			errs = append(errs, errors.New("actorsDB.path must be set for the disk backend"))
+		}
+	case ActorsDBBackendLRU:
+		if cfg.ActorsDB.Capacity <= 0 {
+			errs = append(errs, fmt.Errorf("actorsDB.capacity must be positive, got %d", cfg.ActorsDB.Capacity))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("actorsDB.backend '%s' is not one of memory, disk or lru", cfg.ActorsDB.Backend))
+	}
+	if cfg.ActorsDB.NegativeTTL <= 0 {
+		errs = append(errs, errors.New("actorsDB.negativeTTL must be positive"))
+	}
+
+	if !isTraceSource(cfg.Block.TraceSource) {
+		errs = append(errs, fmt.Errorf("block.traceSource '%s' is not one of %s, %s", cfg.Block.TraceSource,
+			srv.TraceSourceAuto, strings.Join(srv.TraceSources, ", ")))
+	}
+	if cfg.Block.Prefetch.Depth < 0 {
+		errs = append(errs, fmt.Errorf("block.prefetch.depth can't be negative, got %d", cfg.Block.Prefetch.Depth))
+	}
+	if cfg.Block.Prefetch.Depth > 0 && cfg.Block.Prefetch.Concurrency < 1 {
+		errs = append(errs, fmt.Errorf("block.prefetch.concurrency must be at least 1, got %d", cfg.Block.Prefetch.Concurrency))
+	}
+	if cfg.Block.StateCache.MemoryMB < 0 {
+		errs = append(errs, fmt.Errorf("block.stateCache.memoryMB can't be negative, got %d", cfg.Block.StateCache.MemoryMB))
+	}
+	if cfg.Block.StateCache.SpillPath != "" && cfg.Block.StateCache.DiskMB <= 0 {
+		errs = append(errs, fmt.Errorf("block.stateCache.diskMB must be positive when spilling to disk, got %d", cfg.Block.StateCache.DiskMB))
+	}
+	if cfg.Block.StateCache.FinalityDepth < 0 {
+		errs = append(errs, fmt.Errorf("block.stateCache.finalityDepth can't be negative, got %d", cfg.Block.StateCache.FinalityDepth))
+	}
+
+	if cfg.Block.HashIndex.Capacity < 0 {
+		errs = append(errs, fmt.Errorf("block.hashIndex.capacity can't be negative, got %d", cfg.Block.HashIndex.Capacity))
+	}
+	if cfg.Block.HashIndex.Capacity > 0 {
+		if cfg.Block.HashIndex.BackfillDepth < 0 || cfg.Block.HashIndex.BackfillDepth >= cfg.Block.HashIndex.Capacity {
+			errs = append(errs, fmt.Errorf("block.hashIndex.backfillDepth must be between 0 and the capacity, got %d", cfg.Block.HashIndex.BackfillDepth))
+		}
+		if cfg.Block.HashIndex.BackfillDepth > 0 && cfg.Block.HashIndex.BackfillInterval <= 0 {
+			errs = append(errs, errors.New("block.hashIndex.backfillInterval must be positive"))
+		}
+	}
+
+	switch cfg.SafeHead.Mode {
+	case srv.SafeHeadModeOff, srv.SafeHeadModeFinalized:
+	case srv.SafeHeadModeDepth:
+		if cfg.SafeHead.Depth <= 0 {
+			errs = append(errs, fmt.Errorf("safeHead.depth must be positive in depth mode, got %d", cfg.SafeHead.Depth))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("safeHead.mode '%s' is not one of %s", cfg.SafeHead.Mode, strings.Join(srv.SafeHeadModes, ", ")))
+	}
+
+	symbols := map[string]bool{srv.CurrencySymbol: true}
+	for i, token := range cfg.Tokens {
+		if _, err := srv.ParseTokenContract(token.Address); err != nil {
+			errs = append(errs, fmt.Errorf("tokens[%d].address '%s' is not valid: %w", i, token.Address, err))
+		}
+		if token.Symbol == "" || symbols[token.Symbol] {
+			errs = append(errs, fmt.Errorf("tokens[%d].symbol '%s' must be set and unique", i, token.Symbol))
+		}
+		symbols[token.Symbol] = true
+		if token.Decimals < 0 {
+			errs = append(errs, fmt.Errorf("tokens[%d].decimals can't be negative, got %d", i, token.Decimals))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Dump returns the configuration as YAML, with secrets redacted
+func (cfg *Config) Dump() (string, error) {
+	redacted := *cfg
+	if redacted.Lotus.Token != "" {
+		redacted.Lotus.Token = redactedValue
+	}
+
+	out, err := yaml.Marshal(&redacted)
+	if err != nil {
+		return "", err
+	}
+
+	return string(out), nil
+}
+
+// Addr returns the address the proxy listens on
+func (s ServerConfig) Addr() string {
+	return fmt.Sprintf("%s:%d", s.ListenAddress, s.Port)
+}
+
+// Middleware wraps next answering CORS requests as configured
+func (c CORSConfig) Middleware(next http.Handler) http.Handler {
+	if !c.Enabled {
+		return next
+	}
+
+	for _, origin := range c.AllowedOrigins {
+		if origin == "*" {
+			return server.CorsMiddleware(next)
+		}
+	}
+
+	allowed := map[string]bool{}
+	for _, origin := range c.AllowedOrigins {
+		allowed[origin] = true
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if origin := r.Header.Get("Origin"); allowed[origin] {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Add("Vary", "Origin")
+			w.Header().
+				Set("Access-Control-Allow-Headers", "Origin, X-Requested-With, Content-Type, Accept")
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST,OPTIONS")
+		}
+		if r.Method == "OPTIONS" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func isTraceSource(source string) bool {
+	if source == srv.TraceSourceAuto {
+		return true
+	}
+	for _, s := range srv.TraceSources {
+		if s == source {
+			return true
+		}
+	}
+	return false
+}
+
+func isLotusEndpoint(endpoint string) bool {
+	for _, e := range srv.LotusEndpoints {
+		if e == endpoint {
+			return true
+		}
+	}
+	return false
+}
+
+// stringList is a comma separated flag.Value
+type stringList []string
+
+func (l *stringList) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	var values []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	*l = values
+	return nil
+}
+
+// tokenList parses tokens as a comma separated list of address:symbol:decimals
+type tokenList []TokenConfig
+
+func (l *tokenList) String() string {
+	if l == nil {
+		return ""
+	}
+	tokens := make([]string, 0, len(*l))
+	for _, token := range *l {
+		tokens = append(tokens, fmt.Sprintf("%s:%s:%d", token.Address, token.Symbol, token.Decimals))
+	}
+	return strings.Join(tokens, ",")
+}
+
+func (l *tokenList) Set(value string) error {
+	var tokens []TokenConfig
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v == "" {
+			continue
+		}
+		fields := strings.Split(v, ":")
+		if len(fields) != 3 {
+			return fmt.Errorf("token '%s' is not address:symbol:decimals", v)
+		}
+		decimals, err := strconv.ParseInt(fields[2], 10, 32)
+		if err != nil {
+			return fmt.Errorf("decimals of token '%s': %w", v, err)
+		}
+		tokens = append(tokens, TokenConfig{Address: fields[0], Symbol: fields[1], Decimals: int32(decimals)})
+	}
+	*l = tokens
+	return nil
+}
+
+func setString(dst *string) func(string) error {
+	return func(value string) error {
+		*dst = value
+		return nil
+	}
+}
+
+func setInt(dst *int) func(string) error {
+	return func(value string) (err error) {
+		*dst, err = strconv.Atoi(value)
+		return err
+	}
+}
+
+func setBool(dst *bool) func(string) error {
+	return func(value string) (err error) {
+		*dst, err = strconv.ParseBool(value)
+		return err
+	}
+}
+
+func setDuration(dst *time.Duration) func(string) error {
+	return func(value string) (err error) {
+		*dst, err = time.ParseDuration(value)
+		return err
+	}
+}
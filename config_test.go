@@ -0,0 +1,179 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	srv "github.com/zondax/rosetta-filecoin-proxy/rosetta/services"
+	"gotest.tools/assert"
+)
+
+const testConfigFile = `
+server:
+  port: 9000
+  cors:
+    allowedOrigins: ["https://example.com"]
+log:
+  level: debug
+lotus:
+  url: ws://lotus:1234/rpc/v1
+  timeout: 30s
+  endpointTimeouts:
+    /block: 5m
+actorsDB:
+  backend: lru
+  capacity: 500
+`
+
+func mapEnv(env map[string]string) func(string) string {
+	return func(name string) string {
+		return env[name]
+	}
+}
+
+func writeConfigFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NilError(t, os.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	path := writeConfigFile(t, testConfigFile)
+	env := map[string]string{
+		"ROSETTA_PORT":                       "9001",
+		"LOTUS_RPC_TOKEN":                    "secret",
+		"LOTUS_CALL_TIMEOUT_ACCOUNT_BALANCE": "10s",
+	}
+
+	cfg, printConfig, err := loadConfig([]string{"--config", path, "--port", "9002", "--print-config"}, mapEnv(env))
+	assert.NilError(t, err)
+	assert.Assert(t, printConfig)
+
+	// Flags override env vars, which override the config file
+	assert.Equal(t, cfg.Server.Port, 9002)
+	assert.Equal(t, cfg.Log.Level, "debug")
+	assert.Equal(t, cfg.Lotus.URL, "ws://lotus:1234/rpc/v1")
+	assert.Equal(t, cfg.Lotus.Token, "secret")
+	assert.Equal(t, cfg.Lotus.Timeout, 30*time.Second)
+	assert.Equal(t, cfg.Lotus.EndpointTimeouts[srv.BlockEndpoint], 5*time.Minute)
+	assert.Equal(t, cfg.Lotus.EndpointTimeouts[srv.AccountBalanceEndpoint], 10*time.Second)
+	assert.Equal(t, cfg.ActorsDB.Backend, ActorsDBBackendLRU)
+	assert.Equal(t, cfg.ActorsDB.Capacity, 500)
+	assert.DeepEqual(t, cfg.Server.CORS.AllowedOrigins, []string{"https://example.com"})
+	// Not set anywhere
+	assert.Equal(t, cfg.Lotus.Retry.Interval, 5*time.Second)
+	assert.Assert(t, cfg.Server.CORS.Enabled)
+
+	dump, err := cfg.Dump()
+	assert.NilError(t, err)
+	assert.Assert(t, !strings.Contains(dump, "secret"))
+	assert.Assert(t, strings.Contains(dump, "timeout: 30s"))
+}
+
+func TestLoadConfigTokens(t *testing.T) {
+	env := map[string]string{
+		"LOTUS_RPC_URL": "ws://lotus",
+		"TOKENS":        "0x80b98d3aa09ffff255c3ba4a241111ff1262f045:USDFC:18, f01234:WFIL:18",
+	}
+
+	cfg, _, err := loadConfig(nil, mapEnv(env))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, cfg.Tokens, []TokenConfig{
+		{Address: "0x80b98d3aa09ffff255c3ba4a241111ff1262f045", Symbol: "USDFC", Decimals: 18},
+		{Address: "f01234", Symbol: "WFIL", Decimals: 18},
+	})
+}
+
+func TestLoadConfigValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		env     map[string]string
+		wantErr string
+	}{
+		{
+			name:    "MissingLotusURL",
+			wantErr: "lotus.url must be set",
+		},
+		{
+			name:    "OfflineWithoutNetwork",
+			args:    []string{"--offline"},
+			wantErr: "features.networkName must be set in offline mode",
+		},
+		{
+			name:    "InvalidPort",
+			args:    []string{"--lotus-url", "ws://lotus", "--port", "70000"},
+			wantErr: "server.port must be between 1 and 65535",
+		},
+		{
+			name:    "UnknownBackend",
+			env:     map[string]string{"LOTUS_RPC_URL": "ws://lotus", "ACTORS_DB_BACKEND": "redis"},
+			wantErr: "actorsDB.backend 'redis' is not one of memory, disk or lru",
+		},
+		{
+			name:    "MalformedEnv",
+			env:     map[string]string{"LOTUS_RPC_URL": "ws://lotus", "ROSETTA_PORT": "eighty"},
+			wantErr: "invalid value 'eighty' for ROSETTA_PORT",
+		},
+		{
+			name:    "InvalidLogLevel",
+			args:    []string{"--lotus-url", "ws://lotus", "--log-level", "loud"},
+			wantErr: "log.level 'loud' is not valid",
+		},
+		{
+			name:    "UnknownTraceSource",
+			env:     map[string]string{"LOTUS_RPC_URL": "ws://lotus", "BLOCK_TRACE_SOURCE": "StateTrace"},
+			wantErr: "block.traceSource 'StateTrace' is not one of auto, StateCompute, StateReplay, ParentReceipts",
+		},
+		{
+			name:    "InvalidPrefetchConcurrency",
+			env:     map[string]string{"LOTUS_RPC_URL": "ws://lotus", "BLOCK_PREFETCH_DEPTH": "4"},
+			args:    []string{"--block-prefetch-concurrency", "0"},
+			wantErr: "block.prefetch.concurrency must be at least 1",
+		},
+		{
+			name:    "HashIndexBackfillBeyondCapacity",
+			env:     map[string]string{"LOTUS_RPC_URL": "ws://lotus", "BLOCK_HASH_INDEX_CAPACITY": "1000"},
+			wantErr: "block.hashIndex.backfillDepth must be between 0 and the capacity, got 2880",
+		},
+		{
+			name:    "SafeHeadDepthNotSet",
+			env:     map[string]string{"LOTUS_RPC_URL": "ws://lotus", "SAFE_HEAD_MODE": "depth"},
+			wantErr: "safeHead.depth must be positive in depth mode, got 0",
+		},
+		{
+			name:    "InvalidToken",
+			env:     map[string]string{"LOTUS_RPC_URL": "ws://lotus", "TOKENS": "f1abjxfbp274xpdqcpuaykwkfb43omjotacm2p3za:USDFC:18"},
+			wantErr: "tokens[0].address 'f1abjxfbp274xpdqcpuaykwkfb43omjotacm2p3za' is not valid",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := loadConfig(tt.args, mapEnv(tt.env))
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestLoadConfigUnknownEndpoint(t *testing.T) {
+	path := writeConfigFile(t, `
+lotus:
+  url: ws://lotus
+  endpointTimeouts:
+    /blocks: 1m
+`)
+	_, _, err := loadConfig([]string{"--config", path}, mapEnv(nil))
+	assert.ErrorContains(t, err, "unknown endpoint '/blocks'")
+}
+
+func TestLoadConfigUnknownField(t *testing.T) {
+	path := writeConfigFile(t, `
+server:
+  prot: 9000
+`)
+	_, _, err := loadConfig([]string{"--config", path}, mapEnv(nil))
+	assert.ErrorContains(t, err, "field prot not found")
+}
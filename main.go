@@ -2,12 +2,13 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	rosettaFilecoinLib "github.com/zondax/rosetta-filecoin-lib"
 	"net/http"
 	"os"
 	"os/signal"
-	"strconv"
 	"syscall"
 	"time"
 
@@ -22,10 +23,7 @@ import (
 	"github.com/zondax/rosetta-filecoin-proxy/rosetta/tools"
 )
 
-var (
-	BlockchainName = srv.BlockChainName
-	ServerPort, _  = strconv.Atoi(srv.RosettaServerPort)
-)
+var BlockchainName = srv.BlockChainName
 
 func logVersionsInfo() {
 	srv.Logger.Info("****************************************************")
@@ -59,6 +57,7 @@ func newBlockchainRouter(
 	asserter *rosettaAsserter.Asserter,
 	api api.FullNode,
 	rosettaLib *rosettaFilecoinLib.RosettaConstructionFilecoin,
+	features FeaturesConfig,
 ) http.Handler {
 	accountAPIService := srv.NewAccountAPIService(network, &api, rosettaLib)
 	accountAPIController := server.NewAccountAPIController(
@@ -90,17 +89,59 @@ func newBlockchainRouter(
 		asserter,
 	)
 
+	routers := []server.Router{accountAPIController, networkAPIController,
+		blockAPIController, mempoolAPIController, constructionAPIController}
+	if features.Metrics {
+		routers = append(routers, srv.NewMetricsAPIController())
+	}
+
+	return server.NewRouter(routers...)
+}
+
+// newOfflineRouter creates a Mux http.Handler that serves the endpoints
+// that need no chain access. The rest of them answer with ErrOfflineMode.
+func newOfflineRouter(
+	network *types.NetworkIdentifier,
+	asserter *rosettaAsserter.Asserter,
+	rosettaLib *rosettaFilecoinLib.RosettaConstructionFilecoin,
+) http.Handler {
+	var nilNode api.FullNode
+	offlineAPIService := srv.NewOfflineAPIService(network)
+
+	accountAPIController := server.NewAccountAPIController(
+		offlineAPIService,
+		asserter,
+	)
+
+	networkAPIService := srv.NewNetworkAPIService(network, &nilNode, srv.GetSupportedOpList())
+	networkAPIController := server.NewNetworkAPIController(
+		networkAPIService,
+		asserter,
+	)
+
+	blockAPIController := server.NewBlockAPIController(
+		offlineAPIService,
+		asserter,
+	)
+
+	mempoolAPIController := server.NewMempoolAPIController(
+		offlineAPIService,
+		asserter,
+	)
+
+	constructionAPIService := srv.NewConstructionAPIService(network, &nilNode, rosettaLib)
+	constructionAPIController := server.NewConstructionAPIController(
+		constructionAPIService,
+		asserter,
+	)
+
 	return server.NewRouter(accountAPIController, networkAPIController,
 		blockAPIController, mempoolAPIController, constructionAPIController)
 }
 
-func startRosettaRPC(ctx context.Context, api api.FullNode) error {
-	netName, _ := api.StateNetworkName(ctx)
-	network := &types.NetworkIdentifier{
-		Blockchain: BlockchainName,
-		Network:    string(netName),
-	}
-
+// startRosettaRPC serves the rosetta API for the given network. If api is nil,
+// the proxy runs in offline mode.
+func startRosettaRPC(ctx context.Context, network *types.NetworkIdentifier, api api.FullNode, cfg *Config) error {
 	// The asserter automatically rejects incorrectly formatted
 	// requests.
 	asserter, err := rosettaAsserter.NewServer(
@@ -115,13 +156,20 @@ func startRosettaRPC(ctx context.Context, api api.FullNode) error {
 		srv.Logger.Fatal(err)
 	}
 
-	// Create instance of RosettaFilecoinLib for current network
-	r := rosettaFilecoinLib.NewRosettaConstructionFilecoin(api)
+	var router http.Handler
+	if api == nil {
+		// Create an offline instance of RosettaFilecoinLib
+		r := rosettaFilecoinLib.NewRosettaConstructionFilecoin(nil)
+		router = newOfflineRouter(network, asserter, r)
+	} else {
+		// Create instance of RosettaFilecoinLib for current network
+		r := rosettaFilecoinLib.NewRosettaConstructionFilecoin(api)
+		router = newBlockchainRouter(network, asserter, api, r, cfg.Features)
+	}
 
-	router := newBlockchainRouter(network, asserter, api, r)
 	loggedRouter := server.LoggerMiddleware(router)
-	corsRouter := server.CorsMiddleware(loggedRouter)
-	server := &http.Server{Addr: fmt.Sprintf(":%d", ServerPort), Handler: corsRouter}
+	corsRouter := cfg.Server.CORS.Middleware(loggedRouter)
+	server := &http.Server{Addr: cfg.Server.Addr(), Handler: corsRouter}
 
 	sigCh := make(chan os.Signal, 2)
 
@@ -139,7 +187,7 @@ func startRosettaRPC(ctx context.Context, api api.FullNode) error {
 
 	signal.Notify(sigCh, syscall.SIGTERM, syscall.SIGINT)
 
-	srv.Logger.Infof("Rosetta listening on port %d\n", ServerPort)
+	srv.Logger.Infof("Rosetta listening on %s\n", cfg.Server.Addr())
 	return server.ListenAndServe()
 }
 
@@ -167,35 +215,161 @@ func connectAPI(addr string, token string) (api.FullNode, jsonrpc.ClientCloser,
 	return lotusAPI, clientCloser, nil
 }
 
-func setupActorsDatabase(api *api.FullNode) {
-	var db tools.Database = &tools.Cache{}
+func setupActorsDatabase(api *api.FullNode, cfg ActorsDBConfig) {
+	var db tools.Database
+
+	tools.NegativeCacheTTL = cfg.NegativeTTL
+
+	switch cfg.Backend {
+	case ActorsDBBackendDisk:
+		srv.Logger.Infof("Using on-disk actors database at %s", cfg.Path)
+		db = &tools.PersistentCache{Path: cfg.Path}
+	case ActorsDBBackendLRU:
+		srv.Logger.Infof("Using bounded actors database with capacity %d", cfg.Capacity)
+		db = &tools.BoundedCache{Capacity: cfg.Capacity}
+	default:
+		db = &tools.Cache{}
+	}
+
 	db.NewImpl(api)
 	tools.ActorsDB = db
 }
 
+func setupLotusTimeouts(cfg LotusConfig) {
+	srv.LotusCallTimeOut = cfg.Timeout
+	for endpoint, timeout := range cfg.EndpointTimeouts {
+		srv.Logger.Infof("Lotus calls of %s time out after %s", endpoint, timeout)
+		srv.LotusCallTimeOuts[endpoint] = timeout
+	}
+}
+
+func setupTraceSource(source string) {
+	srv.Logger.Infof("Tracing blocks with %s", source)
+	srv.TraceSource = source
+}
+
+func setupBlockPrefetch(cfg PrefetchConfig) {
+	if cfg.Depth > 0 {
+		srv.Logger.Infof("Prefetching %d blocks ahead, %d at a time", cfg.Depth, cfg.Concurrency)
+	}
+	srv.BlockPrefetchDepth = cfg.Depth
+	srv.BlockPrefetchConcurrency = cfg.Concurrency
+}
+
+func setupStateCache(cfg StateCacheConfig) {
+	srv.StateCacheFinalityDepth = cfg.FinalityDepth
+	if cfg.MemoryMB == 0 {
+		return
+	}
+
+	srv.Logger.Infof("Caching StateCompute outputs of tipsets %d epochs below head", cfg.FinalityDepth)
+	cache := &tools.StateComputeCache{
+		MaxMemoryBytes: int64(cfg.MemoryMB) << 20,
+		SpillPath:      cfg.SpillPath,
+		MaxDiskBytes:   int64(cfg.DiskMB) << 20,
+	}
+	cache.Open()
+	tools.StateCache = cache
+}
+
+func setupBlockHashIndex(ctx context.Context, node api.FullNode, cfg HashIndexConfig) {
+	if cfg.Capacity == 0 {
+		return
+	}
+
+	srv.BlockHashIndex = srv.NewTipSetHashIndex(cfg.Capacity)
+	if cfg.BackfillDepth > 0 {
+		srv.Logger.Infof("Indexing the hashes of the last %d epochs", cfg.BackfillDepth)
+		go srv.BlockHashIndex.Backfill(ctx, node, cfg.BackfillDepth, cfg.BackfillInterval)
+	}
+}
+
+func setupSafeHead(cfg SafeHeadConfig) {
+	switch cfg.Mode {
+	case srv.SafeHeadModeDepth:
+		srv.Logger.Infof("Serving the tipset %d epochs below the chain's head as head", cfg.Depth)
+	case srv.SafeHeadModeFinalized:
+		srv.Logger.Info("Serving the latest finalized tipset as head")
+	}
+	srv.SafeHeadMode = cfg.Mode
+	srv.SafeHeadDepth = cfg.Depth
+}
+
+func setupTokens(cfg []TokenConfig) {
+	if len(cfg) == 0 {
+		return
+	}
+
+	tokens := make([]*srv.Token, 0, len(cfg))
+	for _, token := range cfg {
+		// Already validated
+		contract, _ := srv.ParseTokenContract(token.Address)
+		tokens = append(tokens, &srv.Token{Contract: contract, Symbol: token.Symbol, Decimals: token.Decimals})
+		srv.Logger.Infof("Reporting transfers of token %s at %s", token.Symbol, token.Address)
+	}
+	srv.Tokens = srv.NewTokenRegistry(tokens)
+}
+
+func startOffline(cfg *Config) {
+	srv.Logger.Info("Starting Rosetta Proxy in offline mode")
+	srv.Logger.Infof("Network name: %s", cfg.Features.NetworkName)
+	srv.NetworkName = cfg.Features.NetworkName
+
+	network := &types.NetworkIdentifier{
+		Blockchain: BlockchainName,
+		Network:    cfg.Features.NetworkName,
+	}
+
+	err := startRosettaRPC(context.Background(), network, nil, cfg)
+	if err != nil {
+		srv.Logger.Infof("Exit Rosetta rpc: %s", err.Error())
+	}
+}
+
 func main() {
-	startLogger("info")
+	cfg, printConfig, err := loadConfig(os.Args[1:], os.Getenv)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid configuration: %s\n", err.Error())
+		os.Exit(2)
+	}
+
+	if printConfig {
+		dump, err := cfg.Dump()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Could not print configuration: %s\n", err.Error())
+			os.Exit(1)
+		}
+		fmt.Print(dump)
+		return
+	}
+
+	startLogger(cfg.Log.Level)
 	logVersionsInfo()
+	setupLotusTimeouts(cfg.Lotus)
 
-	addr := os.Getenv("LOTUS_RPC_URL")
-	token := os.Getenv("LOTUS_RPC_TOKEN")
+	if cfg.Features.OfflineMode {
+		startOffline(cfg)
+		return
+	}
 
 	srv.Logger.Info("Starting Rosetta Proxy")
-	srv.Logger.Infof("LOTUS_RPC_URL: %s", addr)
+	srv.Logger.Infof("Lotus RPC url: %s", cfg.Lotus.URL)
 
 	var lotusAPI api.FullNode
 	var clientCloser jsonrpc.ClientCloser
-	var err error
 
-	retryAttempts, _ := strconv.Atoi(srv.RetryConnectAttempts)
+	retryAttempts := cfg.Lotus.Retry.Attempts
 
 	for i := 1; i <= retryAttempts; i++ {
-		lotusAPI, clientCloser, err = connectAPI(addr, token)
+		lotusAPI, clientCloser, err = connectAPI(cfg.Lotus.URL, cfg.Lotus.Token)
 		if err == nil {
 			break
 		}
 		srv.Logger.Errorf("Could not connect to api. Retrying attempt %d", i)
-		time.Sleep(5 * time.Second)
+		time.Sleep(cfg.Lotus.Retry.Interval)
 	}
 
 	if err != nil {
@@ -204,10 +378,27 @@ func main() {
 	}
 	defer clientCloser()
 
-	setupActorsDatabase(&lotusAPI)
+	setupActorsDatabase(&lotusAPI, cfg.ActorsDB)
+	defer tools.ActorsDB.Close()
+	setupTraceSource(cfg.Block.TraceSource)
+	setupBlockPrefetch(cfg.Block.Prefetch)
+	setupStateCache(cfg.Block.StateCache)
+	setupSafeHead(cfg.SafeHead)
+	setupTokens(cfg.Tokens)
+	if tools.StateCache != nil {
+		defer tools.StateCache.Close()
+	}
 
 	ctx := context.Background()
-	err = startRosettaRPC(ctx, lotusAPI)
+	setupBlockHashIndex(ctx, lotusAPI, cfg.Block.HashIndex)
+
+	netName, _ := lotusAPI.StateNetworkName(ctx)
+	network := &types.NetworkIdentifier{
+		Blockchain: BlockchainName,
+		Network:    string(netName),
+	}
+
+	err = startRosettaRPC(ctx, network, lotusAPI, cfg)
 	if err != nil {
 		srv.Logger.Infof("Exit Rosetta rpc: %s", err.Error())
 	}
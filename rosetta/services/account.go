@@ -2,6 +2,7 @@ package services
 
 import (
 	"context"
+	"errors"
 	rosettaFilecoinLib "github.com/zondax/rosetta-filecoin-lib"
 	"github.com/zondax/rosetta-filecoin-lib/actors"
 	"strconv"
@@ -12,6 +13,7 @@ import (
 	"github.com/filecoin-project/go-state-types/abi"
 	"github.com/filecoin-project/lotus/api"
 	filTypes "github.com/filecoin-project/lotus/chain/types"
+	"github.com/zondax/rosetta-filecoin-proxy/rosetta/tools"
 )
 
 // AccountAPIService implements the server.BlockAPIServicer interface.
@@ -33,6 +35,7 @@ func NewAccountAPIService(network *types.NetworkIdentifier, node *api.FullNode,
 // AccountBalance implements the /account/balance endpoint.
 func (a AccountAPIService) AccountBalance(ctx context.Context,
 	request *types.AccountBalanceRequest) (*types.AccountBalanceResponse, *types.Error) {
+	ctx = withEndpoint(ctx, AccountBalanceEndpoint)
 
 	errNet := ValidateNetworkId(ctx, &a.node, request.NetworkIdentifier)
 	if errNet != nil {
@@ -44,6 +47,19 @@ func (a AccountAPIService) AccountBalance(ctx context.Context,
 		return nil, BuildError(ErrInvalidAccountAddress, nil, true)
 	}
 
+	currencies, currencyErr := requestedCurrencies(request.Currencies)
+	if currencyErr != nil {
+		return nil, currencyErr
+	}
+	// Datacap is held by the account as a whole
+	if request.AccountIdentifier.SubAccount != nil {
+		for _, currency := range currencies {
+			if currency.Symbol == DatacapSymbol {
+				return nil, BuildError(ErrSubAccountCurrency, nil, true)
+			}
+		}
+	}
+
 	// Check sync status
 	status, syncErr := CheckSyncStatus(ctx, &a.node)
 	if syncErr != nil {
@@ -55,9 +71,10 @@ func (a AccountAPIService) AccountBalance(ctx context.Context,
 
 	useHeadTipSet := false
 
-	var queryTipSet *filTypes.TipSet    // TipSet to use on StateGetActor
-	var responseTipSet *filTypes.TipSet // TipSet to get queryTipSetHeight and queryTipSetHash values for response
-	var headTipSet *filTypes.TipSet     // Chain's head TipSet
+	var queryTipSet *filTypes.TipSet     // TipSet to use on StateGetActor
+	var responseTipSet *filTypes.TipSet  // TipSet to get queryTipSetHeight and queryTipSetHash values for response
+	var requestedTipSet *filTypes.TipSet // TipSet at the requested height, to check the requested hash against
+	var headTipSet *filTypes.TipSet      // Chain's head TipSet
 
 	var fixedQueryHeight int64
 	var originalQueryHeight int64
@@ -66,17 +83,28 @@ func (a AccountAPIService) AccountBalance(ctx context.Context,
 	var queryTipSetHeight int64
 	var queryTipSetHash *string
 
-	headTipSet, filErr = a.node.ChainHead(ctx)
+	headTipSet, filErr = tools.LotusCall(ctx, lotusCallTimeout(ctx), func(ctx context.Context) (*filTypes.TipSet, error) {
+		return a.node.ChainHead(ctx)
+	})
+	if filErr != nil {
+		return nil, BuildLotusError(ErrUnableToGetLatestBlk, filErr, true)
+	}
+
+	// The safe head is the chain's head as far as clients are concerned
+	headTipSet, filErr = safeHeadOf(ctx, a.node, headTipSet)
 	if filErr != nil {
-		return nil, BuildError(ErrUnableToGetLatestBlk, filErr, true)
+		return nil, BuildLotusError(ErrUnableToGetLatestBlk, filErr, true)
 	}
 
 	if request.BlockIdentifier != nil {
-		if request.BlockIdentifier.Index == nil {
-			return nil, BuildError(ErrInsufficientQueryInputs, nil, true)
+		var heightErr *types.Error
+		originalQueryHeight, heightErr = resolveBlockHeight(request.BlockIdentifier)
+		if heightErr != nil {
+			return nil, heightErr
+		}
+		if safeHeadEnabled() && originalQueryHeight > int64(headTipSet.Height()) {
+			return nil, BuildError(ErrBlockNotConfirmed, nil, true)
 		}
-
-		originalQueryHeight = *request.BlockIdentifier.Index
 		// From lotus v1.5 and on, StateGetActor computes the state at parent's tipSet.
 		// To get the state on the requested height, we need to query the block at (height + 1).
 
@@ -93,28 +121,43 @@ func (a AccountAPIService) AccountBalance(ctx context.Context,
 
 	if useHeadTipSet {
 		queryTipSet = headTipSet
-		responseTipSet, filErr = a.node.ChainGetTipSet(ctx, headTipSet.Parents())
+		requestedTipSet = headTipSet
+		responseTipSet, filErr = tools.LotusCall(ctx, lotusCallTimeout(ctx), func(ctx context.Context) (*filTypes.TipSet, error) {
+			return a.node.ChainGetTipSet(ctx, headTipSet.Parents())
+		})
 		if filErr != nil {
-			return nil, BuildError(ErrUnableToGetParentBlk, filErr, true)
+			return nil, BuildLotusError(ErrUnableToGetParentBlk, filErr, true)
 		}
 	} else {
-		queryTipSet, filErr = a.node.ChainGetTipSetByHeight(ctx, abi.ChainEpoch(fixedQueryHeight), filTypes.EmptyTSK)
+		queryTipSet, filErr = a.getTipSetByHeight(ctx, fixedQueryHeight)
 		if filErr != nil {
-			return nil, BuildError(ErrUnableToGetBlk, filErr, true)
+			return nil, BuildLotusError(ErrUnableToGetBlk, filErr, true)
 		}
 		if queryTipSet.Height() == abi.ChainEpoch(originalQueryHeight) {
 			// Means that the tipset at originalQueryHeight + 1 has no blocks, so we need to skip it
 			fixedQueryHeight = originalQueryHeight + 2
 
 			// Repeat the call with the updated height
-			queryTipSet, filErr = a.node.ChainGetTipSetByHeight(ctx, abi.ChainEpoch(fixedQueryHeight), filTypes.EmptyTSK)
+			queryTipSet, filErr = a.getTipSetByHeight(ctx, fixedQueryHeight)
 			if filErr != nil {
-				return nil, BuildError(ErrUnableToGetBlk, filErr, true)
+				return nil, BuildLotusError(ErrUnableToGetBlk, filErr, true)
 			}
 		}
-		responseTipSet, filErr = a.node.ChainGetTipSetByHeight(ctx, abi.ChainEpoch(originalQueryHeight), filTypes.EmptyTSK)
+		responseTipSet, filErr = a.getTipSetByHeight(ctx, originalQueryHeight)
 		if filErr != nil {
-			return nil, BuildError(ErrUnableToGetBlk, filErr, true)
+			return nil, BuildLotusError(ErrUnableToGetBlk, filErr, true)
+		}
+		requestedTipSet = responseTipSet
+	}
+
+	// The tipset at the height of the requested hash may have been replaced by a reorg
+	if request.BlockIdentifier != nil && request.BlockIdentifier.Hash != nil {
+		requestedHash, hashErr := BuildTipSetKeyHash(requestedTipSet.Key())
+		if hashErr != nil {
+			return nil, BuildError(ErrUnableToBuildTipSetHash, hashErr, true)
+		}
+		if *requestedHash != *request.BlockIdentifier.Hash {
+			return nil, BuildError(ErrInvalidHash, nil, true)
 		}
 	}
 
@@ -124,28 +167,46 @@ func (a AccountAPIService) AccountBalance(ctx context.Context,
 	if filErr != nil {
 		return nil, BuildError(ErrUnableToBuildTipSetHash, filErr, true)
 	}
+	BlockHashIndex.Add(*queryTipSetHash, responseTipSet.Height())
 
-	actor, err := a.node.StateGetActor(ctx, addr, queryTipSet.Key())
+	actor, err := tools.LotusCall(ctx, lotusCallTimeout(ctx), func(ctx context.Context) (*filTypes.Actor, error) {
+		return a.node.StateGetActor(ctx, addr, queryTipSet.Key())
+	})
+	if errors.Is(err, tools.ErrCallTimedOut) {
+		return nil, BuildLotusError(ErrUnableToGetActor, err, true)
+	}
 	if err != nil {
 		// If actor is not found on chain, return 0 balance
+		balances := []*types.Amount{}
+		for _, currency := range currencies {
+			balances = append(balances, &types.Amount{
+				Value:    "0",
+				Currency: currency,
+			})
+		}
 		return &types.AccountBalanceResponse{
 			BlockIdentifier: &types.BlockIdentifier{
 				Index: queryTipSetHeight,
 				Hash:  *queryTipSetHash,
 			},
-			Balances: []*types.Amount{
-				{
-					Value:    "0",
-					Currency: GetCurrencyData(),
-				},
-			},
+			Balances: balances,
 		}, nil
 	}
 
 	md := make(map[string]interface{})
 
-	if request.AccountIdentifier.SubAccount != nil {
-		// First, check if account is a multisig
+	if request.AccountIdentifier.SubAccount != nil && a.rosettaLib.BuiltinActors.IsActor(actor.Code, actors.ActorStorageMinerName) {
+		subAccount := request.AccountIdentifier.SubAccount.Address
+		if !isMinerSubAccount(subAccount) {
+			return nil, BuildError(ErrMustSpecifyMinerSubAccount, nil, true)
+		}
+		balance, err := getMinerSubAccountBalance(ctx, a.node, actor, subAccount)
+		if err != nil {
+			return nil, BuildLotusError(ErrUnableToGetBalance, err, true)
+		}
+		balanceStr = balance.String()
+	} else if request.AccountIdentifier.SubAccount != nil {
+		// Otherwise, the account must be a multisig
 		if !a.rosettaLib.BuiltinActors.IsActor(actor.Code, actors.ActorMultisigName) {
 			return nil, BuildError(ErrAddNotMSig, nil, true)
 		}
@@ -153,22 +214,24 @@ func (a AccountAPIService) AccountBalance(ctx context.Context,
 		switch request.AccountIdentifier.SubAccount.Address {
 		case LockedBalanceStr:
 			lockedBalance := actor.Balance
-			spendableBalance, err := a.node.MsigGetAvailableBalance(ctx, addr, queryTipSet.Key())
+			spendableBalance, err := a.getMsigAvailableBalance(ctx, addr, queryTipSet.Key())
 			if err != nil {
-				return nil, BuildError(ErrUnableToGetBalance, err, true)
+				return nil, BuildLotusError(ErrUnableToGetBalance, err, true)
 			}
 			lockedBalance.Sub(lockedBalance.Int, spendableBalance.Int)
 			balanceStr = lockedBalance.String()
 		case SpendableBalanceStr:
-			spendableBalance, err := a.node.MsigGetAvailableBalance(ctx, addr, queryTipSet.Key())
+			spendableBalance, err := a.getMsigAvailableBalance(ctx, addr, queryTipSet.Key())
 			if err != nil {
-				return nil, BuildError(ErrUnableToGetBalance, err, true)
+				return nil, BuildLotusError(ErrUnableToGetBalance, err, true)
 			}
 			balanceStr = spendableBalance.String()
 		case VestingScheduleStr:
-			vestingSch, err := a.node.MsigGetVestingSchedule(ctx, addr, queryTipSet.Key())
+			vestingSch, err := tools.LotusCall(ctx, lotusCallTimeout(ctx), func(ctx context.Context) (api.MsigVesting, error) {
+				return a.node.MsigGetVestingSchedule(ctx, addr, queryTipSet.Key())
+			})
 			if err != nil {
-				return nil, BuildError(ErrUnableToGetVesting, err, true)
+				return nil, BuildLotusError(ErrUnableToGetVesting, err, true)
 			}
 			vestingMap := map[string]string{}
 			vestingMap[VestingStartEpochKey] = vestingSch.StartEpoch.String()
@@ -186,23 +249,46 @@ func (a AccountAPIService) AccountBalance(ctx context.Context,
 	// Fill nonce
 	md[NonceKey] = strconv.FormatUint(actor.Nonce, 10)
 
+	balances := []*types.Amount{}
+	for _, currency := range currencies {
+		value := balanceStr
+		if currency.Symbol == DatacapSymbol {
+			dataCap, err := getDatacapBalance(ctx, a.node, addr, queryTipSet.Key())
+			if err != nil {
+				return nil, BuildLotusError(ErrUnableToGetBalance, err, true)
+			}
+			value = dataCap.String()
+		}
+		balances = append(balances, &types.Amount{
+			Value:    value,
+			Currency: currency,
+		})
+	}
+
 	resp := &types.AccountBalanceResponse{
 		BlockIdentifier: &types.BlockIdentifier{
 			Index: queryTipSetHeight,
 			Hash:  *queryTipSetHash,
 		},
-		Balances: []*types.Amount{
-			{
-				Value:    balanceStr,
-				Currency: GetCurrencyData(),
-			},
-		},
+		Balances: balances,
 		Metadata: md,
 	}
 
 	return resp, nil
 }
 
+func (a AccountAPIService) getTipSetByHeight(ctx context.Context, height int64) (*filTypes.TipSet, error) {
+	return tools.LotusCall(ctx, lotusCallTimeout(ctx), func(ctx context.Context) (*filTypes.TipSet, error) {
+		return a.node.ChainGetTipSetByHeight(ctx, abi.ChainEpoch(height), filTypes.EmptyTSK)
+	})
+}
+
+func (a AccountAPIService) getMsigAvailableBalance(ctx context.Context, addr address.Address, key filTypes.TipSetKey) (filTypes.BigInt, error) {
+	return tools.LotusCall(ctx, lotusCallTimeout(ctx), func(ctx context.Context) (filTypes.BigInt, error) {
+		return a.node.MsigGetAvailableBalance(ctx, addr, key)
+	})
+}
+
 func (a AccountAPIService) AccountCoins(ctx context.Context, request *types.AccountCoinsRequest) (*types.AccountCoinsResponse, *types.Error) {
 	return nil, ErrNotImplemented
 }
@@ -3,42 +3,138 @@ package services
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"github.com/zondax/rosetta-filecoin-lib/actors"
+	"strings"
 	"time"
 
 	"github.com/coinbase/rosetta-sdk-go/server"
 	"github.com/coinbase/rosetta-sdk-go/types"
+	"github.com/filecoin-project/go-address"
 	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/filecoin-project/go-state-types/builtin"
+	"github.com/filecoin-project/go-state-types/builtin/v17/reward"
 	"github.com/filecoin-project/lotus/api"
 	filTypes "github.com/filecoin-project/lotus/chain/types"
 	initActor "github.com/filecoin-project/specs-actors/v8/actors/builtin/init"
+	"github.com/ipfs/go-cid"
 	filLib "github.com/zondax/rosetta-filecoin-lib"
 	"github.com/zondax/rosetta-filecoin-proxy/rosetta/tools"
 )
 
-// LotusCallTimeOut TimeOut for RPC Lotus calls
-const LotusCallTimeOut = 60 * 4 * time.Second
+// Names of the keys in the Metadata map inside a BlockResponse. The per block
+// values are lists following the order of the blocks' CIDs inside the TipSet.
+const (
+	// BlockCIDsKey specifies blocks' CIDs inside a TipSet.
+	BlockCIDsKey = "blockCIDs"
+	// BlockMinersKey specifies the miner of each block.
+	BlockMinersKey = "blockMiners"
+	// BlockWinCountsKey specifies the number of rewards won by each block's election proof.
+	BlockWinCountsKey = "blockWinCounts"
+	// BlockTicketsKey specifies each block's ticket VRF proof, base64 encoded.
+	BlockTicketsKey = "blockTickets"
+	// BlockMessageCountsKey specifies the number of messages included in each block.
+	BlockMessageCountsKey = "blockMessageCounts"
+	// ParentBaseFeeKey specifies the base fee after executing the parent TipSet, in attoFIL.
+	ParentBaseFeeKey = "parentBaseFee"
+	// ParentWeightKey specifies the chain weight at the parent TipSet.
+	ParentWeightKey = "parentWeight"
+	// ParentStateRootKey specifies the state root CID after executing the parent TipSet.
+	ParentStateRootKey = "parentStateRoot"
+	// TipSetKeyKey specifies the TipSetKey, as in Lotus' API.
+	TipSetKeyKey = "tipSetKey"
+	// BlockSummaryKey specifies the BlockSummary of the messages executed in the TipSet.
+	BlockSummaryKey = "summary"
+)
+
+// BlockSummary aggregates the fees, value and gas of the messages included in the
+// blocks of a TipSet. Implicit messages are left out, as they pay no fees.
+type BlockSummary struct {
+	TotalFees          abi.TokenAmount `json:"totalFees"`
+	BaseFeeBurn        abi.TokenAmount `json:"baseFeeBurn"`
+	OverEstimationBurn abi.TokenAmount `json:"overEstimationBurn"`
+	MinerTips          abi.TokenAmount `json:"minerTips"`
+	ValueTransferred   abi.TokenAmount `json:"valueTransferred"` // by successful messages only
+	Messages           int             `json:"messages"`
+	FailedMessages     int             `json:"failedMessages"`
+	GasUsed            int64           `json:"gasUsed"`
+	GasLimit           int64           `json:"gasLimit"`
+}
+
+func newBlockSummary() *BlockSummary {
+	return &BlockSummary{
+		TotalFees:          big.Zero(),
+		BaseFeeBurn:        big.Zero(),
+		OverEstimationBurn: big.Zero(),
+		MinerTips:          big.Zero(),
+		ValueTransferred:   big.Zero(),
+	}
+}
+
+// add accumulates the execution of an included message into the summary
+func (b *BlockSummary) add(trace *api.InvocResult) {
+	b.Messages++
+	b.TotalFees = big.Add(b.TotalFees, bigOrZero(trace.GasCost.TotalCost))
+	b.BaseFeeBurn = big.Add(b.BaseFeeBurn, bigOrZero(trace.GasCost.BaseFeeBurn))
+	b.OverEstimationBurn = big.Add(b.OverEstimationBurn, bigOrZero(trace.GasCost.OverEstimationBurn))
+	b.MinerTips = big.Add(b.MinerTips, bigOrZero(trace.GasCost.MinerTip))
+	b.GasLimit += trace.Msg.GasLimit
 
-// BlockCIDsKey is the name of the key in the Metadata map inside a
-// BlockResponse that specifies blocks' CIDs inside a TipSet.
-const BlockCIDsKey = "blockCIDs"
+	if trace.MsgRct == nil {
+		return
+	}
+	b.GasUsed += trace.MsgRct.GasUsed
+	if trace.MsgRct.ExitCode.IsSuccess() {
+		b.ValueTransferred = big.Add(b.ValueTransferred, bigOrZero(trace.Msg.Value))
+	} else {
+		b.FailedMessages++
+	}
+}
+
+func bigOrZero(amount abi.TokenAmount) abi.TokenAmount {
+	if amount.Int == nil {
+		return big.Zero()
+	}
+	return amount
+}
+
+// ImplicitTxPrefix prefixes the synthetic identifiers of the transactions built from
+// implicit messages (block rewards and cron ticks), which are applied by the system
+// actor without being included in any block. See ImplicitTxHash.
+const ImplicitTxPrefix = "implicit-"
+
+// ImplicitMethodKey is the name of the key in the Metadata map of a Transaction
+// built from an implicit message that specifies the method it executed.
+const ImplicitMethodKey = "implicitMethod"
 
 // BlockAPIService implements the server.BlockAPIServicer interface.
 type BlockAPIService struct {
 	network    *types.NetworkIdentifier
 	node       api.FullNode
 	rosettaLib *filLib.RosettaConstructionFilecoin
+	// nil when prefetching is disabled, see BlockPrefetchDepth
+	prefetcher  *blockPrefetcher
+	traceSource *traceSourceSelector
+	finality    *finalityTracker
 }
 
 // NewBlockAPIService creates a new instance of a BlockAPIService.
 func NewBlockAPIService(network *types.NetworkIdentifier, api *api.FullNode, r *filLib.RosettaConstructionFilecoin) server.BlockAPIServicer {
-	return &BlockAPIService{
-		network:    network,
-		node:       *api,
-		rosettaLib: r,
+	service := &BlockAPIService{
+		network:     network,
+		node:        *api,
+		rosettaLib:  r,
+		traceSource: newTraceSourceSelector(TraceSource),
+		finality:    newFinalityTracker(*api),
+	}
+	if BlockPrefetchDepth > 0 {
+		service.prefetcher = newBlockPrefetcher(*api, BlockPrefetchDepth, BlockPrefetchConcurrency)
 	}
+
+	return service
 }
 
 // Block implements the /block endpoint.
@@ -46,12 +142,13 @@ func (s *BlockAPIService) Block(
 	ctx context.Context,
 	request *types.BlockRequest,
 ) (*types.BlockResponse, *types.Error) {
+	ctx = withEndpoint(ctx, BlockEndpoint)
 
 	if request.BlockIdentifier == nil {
 		return nil, BuildError(ErrMalformedValue, nil, true)
 	}
 
-	if request.BlockIdentifier == nil && request.BlockIdentifier.Hash == nil {
+	if request.BlockIdentifier.Index == nil && request.BlockIdentifier.Hash == nil {
 		return nil, BuildError(ErrInsufficientQueryInputs, nil, true)
 	}
 
@@ -60,7 +157,10 @@ func (s *BlockAPIService) Block(
 		return nil, errNet
 	}
 
-	requestedHeight := *request.BlockIdentifier.Index
+	requestedHeight, heightErr := resolveBlockHeight(request.BlockIdentifier)
+	if heightErr != nil {
+		return nil, heightErr
+	}
 	if requestedHeight < 0 {
 		return nil, BuildError(ErrMalformedValue, nil, true)
 	}
@@ -74,23 +174,21 @@ func (s *BlockAPIService) Block(
 		return nil, BuildError(ErrUnableToGetUnsyncedBlock, nil, true)
 	}
 
-	if request.BlockIdentifier.Index == nil {
-		return nil, BuildError(ErrInsufficientQueryInputs, nil, true)
-	}
-
-	var tipSet *filTypes.TipSet
-	var err error
-	impl := func() {
-		tipSet, err = s.node.ChainGetTipSetByHeight(ctx, abi.ChainEpoch(requestedHeight), filTypes.EmptyTSK)
-	}
-
-	errTimeOut := tools.WrapWithTimeout(impl, LotusCallTimeOut)
-	if errTimeOut != nil {
-		return nil, ErrLotusCallTimedOut
+	if safeHeadEnabled() {
+		safeHead, err := getSafeHead(ctx, s.node)
+		if err != nil {
+			return nil, BuildLotusError(ErrUnableToGetLatestBlk, err, true)
+		}
+		if requestedHeight > int64(safeHead.Height()) {
+			return nil, BuildError(ErrBlockNotConfirmed, nil, true)
+		}
 	}
 
+	tipSet, err := tools.LotusCall(ctx, lotusCallTimeout(ctx), func(ctx context.Context) (*filTypes.TipSet, error) {
+		return s.node.ChainGetTipSetByHeight(ctx, abi.ChainEpoch(requestedHeight), filTypes.EmptyTSK)
+	})
 	if err != nil {
-		return nil, BuildError(ErrUnableToGetTipset, err, true)
+		return nil, BuildLotusError(ErrUnableToGetTipset, err, true)
 	}
 
 	// If a TipSet has empty blocks, lotus api will return a TipSet at a different epoch
@@ -110,21 +208,22 @@ func (s *BlockAPIService) Block(
 		}
 	}
 
+	// Start computing the next blocks while this one is served
+	if s.prefetcher != nil && s.traceSource.current() == TraceSourceStateCompute {
+		s.prefetcher.prefetch(tipSet.Height())
+	}
+
 	// Get parent TipSet
 	var parentTipSet *filTypes.TipSet
 	if requestedHeight > 0 {
 		if tipSet.Parents().IsEmpty() {
 			return nil, BuildError(ErrUnableToGetParentBlk, nil, true)
 		}
-		impl = func() {
-			parentTipSet, err = s.node.ChainGetTipSet(ctx, tipSet.Parents())
-		}
-		errTimeOut = tools.WrapWithTimeout(impl, LotusCallTimeOut)
-		if errTimeOut != nil {
-			return nil, ErrLotusCallTimedOut
-		}
+		parentTipSet, err = tools.LotusCall(ctx, lotusCallTimeout(ctx), func(ctx context.Context) (*filTypes.TipSet, error) {
+			return s.node.ChainGetTipSet(ctx, tipSet.Parents())
+		})
 		if err != nil {
-			return nil, BuildError(ErrUnableToGetParentBlk, err, true)
+			return nil, BuildLotusError(ErrUnableToGetParentBlk, err, true)
 		}
 	} else {
 		// According to rosetta docs, if the requested tipset is
@@ -132,23 +231,47 @@ func (s *BlockAPIService) Block(
 		parentTipSet = tipSet
 	}
 
+	blocksMsgs, blocksMsgsErr := getBlocksMessages(ctx, &s.node, tipSet)
+	if blocksMsgsErr != nil {
+		return nil, blocksMsgsErr
+	}
+
 	// Build transactions data
 	var transactions *[]*types.Transaction
+	var summary *BlockSummary
+	var traceSource string
 	if requestedHeight > 1 {
-		states, err := getLotusStateCompute(ctx, &s.node, tipSet)
+		// The height synced is the chain's head, no need to ask Lotus for it again
+		states, source, err := s.getTraces(ctx, tipSet, blocksMsgs, abi.ChainEpoch(status.GetMaxHeight()))
+		if err != nil {
+			return nil, err
+		}
+		transfers, err := s.getTokenTransfers(ctx, states)
 		if err != nil {
 			return nil, err
 		}
-		transactions = s.buildTransactions(states)
+		transactions, summary = s.buildTransactions(ctx, states, tipSet, getMessagesMiners(tipSet, blocksMsgs), transfers)
+		markUntracedSubcalls(*transactions, source)
+		traceSource = source
 	}
 
 	// Add block metadata
-	md := make(map[string]interface{})
-	var blockCIDs []string
-	for _, cid := range tipSet.Cids() {
-		blockCIDs = append(blockCIDs, cid.String())
+	md := buildTipSetMetadata(tipSet, blocksMsgs)
+	if summary != nil {
+		md[BlockSummaryKey] = summary
+	}
+	if traceSource != "" {
+		addTraceSourceMetadata(md, traceSource)
+	}
+	if s.finality != nil {
+		finalized, source, err := s.finality.isFinalized(ctx, tipSet.Height())
+		if err != nil {
+			Logger.Warnf("could not get the finality of height %d: %s", tipSet.Height(), err.Error())
+		} else {
+			md[FinalizedKey] = finalized
+			md[FinalitySourceKey] = source
+		}
 	}
-	md[BlockCIDsKey] = blockCIDs
 
 	hashTipSet, err := BuildTipSetKeyHash(tipSet.Key())
 	if err != nil {
@@ -167,6 +290,9 @@ func (s *BlockAPIService) Block(
 	parentBlockId.Index = int64(parentTipSet.Height())
 	parentBlockId.Hash = *hashParentTipSet
 
+	BlockHashIndex.Add(*hashTipSet, tipSet.Height())
+	BlockHashIndex.Add(*hashParentTipSet, parentTipSet.Height())
+
 	respBlock := &types.Block{
 		BlockIdentifier:       blockId,
 		ParentBlockIdentifier: parentBlockId,
@@ -184,62 +310,269 @@ func (s *BlockAPIService) Block(
 	return resp, nil
 }
 
-func (s *BlockAPIService) buildTransactions(states *api.ComputeStateOutput) *[]*types.Transaction {
+// buildTransactions returns the transactions resulting from the traces in states, and the
+// summary of the messages included in tipSet. miners is given by getMessagesMiners, and
+// transfers by getTokenTransfers.
+func (s *BlockAPIService) buildTransactions(ctx context.Context, states *api.ComputeStateOutput, tipSet *filTypes.TipSet,
+	miners map[cid.Cid]address.Address, transfers map[cid.Cid][]*TokenTransfer) (*[]*types.Transaction, *BlockSummary) {
 	defer TimeTrack(time.Now(), "[Proxy]TraceAnalysis")
 
 	var transactions []*types.Transaction
-	for i := range states.Trace {
-		trace := states.Trace[i]
+	summary := newBlockSummary()
+	txHashes := traceTxHashes(states, tipSet.Height())
+	for i, trace := range states.Trace {
+		if trace == nil || trace.Msg == nil {
+			continue
+		}
+		if _, ok := miners[trace.MsgCid]; ok {
+			summary.add(trace)
+		}
 
-		if trace.Msg == nil {
+		tx := s.buildTransaction(ctx, trace, txHashes[i], tipSet, miners, transfers[trace.MsgCid])
+		if tx != nil {
+			transactions = append(transactions, tx)
+		}
+	}
+
+	return &transactions, summary
+}
+
+// buildTransaction analyzes a single message trace and returns the resulting
+// transaction identified by txHash, or nil if the trace doesn't produce any operation.
+// miners maps the messages included in tipSet to the miner receiving their tip, and
+// transfers are the token transfers made by the message.
+func (s *BlockAPIService) buildTransaction(ctx context.Context, trace *api.InvocResult, txHash string, tipSet *filTypes.TipSet,
+	miners map[cid.Cid]address.Address, transfers []*TokenTransfer) *types.Transaction {
+	if trace == nil || trace.Msg == nil {
+		return nil
+	}
+
+	var operations []*types.Operation
+
+	// Analyze full trace recursively
+	execTrace := &trace.ExecutionTrace
+	implicit := isImplicitMessage(trace.Msg)
+	if implicit {
+		execTrace = withoutGasReward(execTrace)
+	}
+	s.processTrace(ctx, execTrace, tipSet, &operations)
+	operations = s.appendTokenOps(ctx, operations, transfers, tipSet)
+	if len(operations) == 0 {
+		return nil
+	}
+
+	// Add the fee operations. Implicit messages aren't included in any block and pay no fees.
+	if miner, ok := miners[trace.MsgCid]; ok {
+		operations = appendFeeOps(operations, trace.Msg.From, miner, &trace.GasCost)
+	}
+
+	transaction := &types.Transaction{
+		TransactionIdentifier: &types.TransactionIdentifier{
+			Hash: txHash,
+		},
+		Operations: operations,
+	}
+
+	if implicit {
+		method, err := GetMethodName(ctx, &trace.ExecutionTrace.Msg, s.rosettaLib, tipSet)
+		if err != nil {
+			method = actors.UnknownStr
+		}
+		transaction.Metadata = map[string]interface{}{
+			ImplicitMethodKey: method,
+		}
+	}
+
+	return transaction
+}
+
+// isImplicitMessage returns whether msg is an implicit message, applied by the system
+// actor on every tipset (block rewards and cron ticks), instead of one included in a block
+func isImplicitMessage(msg *filTypes.Message) bool {
+	return msg.From == builtin.SystemActorAddr
+}
+
+// ImplicitTxHash returns the synthetic identifier of the transaction built from the
+// index-th implicit message applied at height, in StateCompute's execution order
+func ImplicitTxHash(height abi.ChainEpoch, index int) string {
+	return fmt.Sprintf("%s%d-%d", ImplicitTxPrefix, height, index)
+}
+
+// traceTxHashes returns the transaction identifier of each trace in states: the message
+// CID for explicit messages, and the one given by ImplicitTxHash for implicit messages
+func traceTxHashes(states *api.ComputeStateOutput, height abi.ChainEpoch) []string {
+	txHashes := make([]string, len(states.Trace))
+	implicitIndex := 0
+	for i, trace := range states.Trace {
+		if trace == nil || trace.Msg == nil {
 			continue
 		}
+		if isImplicitMessage(trace.Msg) {
+			txHashes[i] = ImplicitTxHash(height, implicitIndex)
+			implicitIndex++
+			continue
+		}
+		txHashes[i] = trace.MsgCid.String()
+	}
 
-		var operations []*types.Operation
+	return txHashes
+}
 
-		// Analyze full trace recursively
-		s.processTrace(&trace.ExecutionTrace, &operations)
-		if len(operations) > 0 {
-			// Add the corresponding "Fee" operation
-			if !trace.GasCost.TotalCost.Nil() {
-				opStatus := OperationStatusOk
-				operations = appendOp(operations, "Fee", trace.Msg.From.String(),
-					trace.GasCost.TotalCost.Neg().String(), opStatus, false)
-			}
+// withoutGasReward returns a copy of an AwardBlockReward trace where the miner's
+// ApplyRewards subcall only carries the block reward. The gas reward it also pays
+// is made of the tips already credited to the miner by the messages' MinerTip
+// operations. Other traces are returned unchanged.
+func withoutGasReward(trace *filTypes.ExecutionTrace) *filTypes.ExecutionTrace {
+	if trace.Msg.To != builtin.RewardActorAddr || trace.Msg.Method != builtin.MethodsReward.AwardBlockReward {
+		return trace
+	}
 
-			tx := types.Transaction{
-				TransactionIdentifier: &types.TransactionIdentifier{
-					Hash: trace.MsgCid.String(),
-				},
-				Operations: operations,
-			}
+	var params reward.AwardBlockRewardParams
+	if err := params.UnmarshalCBOR(bytes.NewReader(trace.Msg.Params)); err != nil {
+		Logger.Error("could not parse AwardBlockReward params. Err:", err.Error())
+		return trace
+	}
+	if params.GasReward.NilOrZero() {
+		return trace
+	}
 
-			transactions = append(transactions, &tx)
+	rewardTrace := *trace
+	rewardTrace.Subcalls = make([]filTypes.ExecutionTrace, len(trace.Subcalls))
+	copy(rewardTrace.Subcalls, trace.Subcalls)
+	for i := range rewardTrace.Subcalls {
+		subcall := &rewardTrace.Subcalls[i]
+		if subcall.Msg.To == params.Miner && subcall.Msg.Method == builtin.MethodsMiner.ApplyRewards {
+			subcall.Msg.Value = big.Sub(subcall.Msg.Value, params.GasReward)
+			break
 		}
 	}
 
-	return &transactions
+	return &rewardTrace
 }
 
-func getLotusStateCompute(ctx context.Context, node *api.FullNode, tipSet *filTypes.TipSet) (*api.ComputeStateOutput, *types.Error) {
-	defer TimeTrack(time.Now(), "[Lotus]StateCompute")
+// appendFeeOps appends the gas fee paid by sender, split in the base fee and over estimation
+// burns, credited to the burnt funds actor, and the tip credited to miner
+func appendFeeOps(ops []*types.Operation, sender address.Address, miner address.Address,
+	gasCost *api.MsgGasCost) []*types.Operation {
+	fees := []struct {
+		opType    string
+		amount    abi.TokenAmount
+		recipient address.Address
+	}{
+		{OpBaseFeeBurn, gasCost.BaseFeeBurn, builtin.BurntFundsActorAddr},
+		{OpOverEstimationBurn, gasCost.OverEstimationBurn, builtin.BurntFundsActorAddr},
+		{OpMinerTip, gasCost.MinerTip, miner},
+	}
+
+	// Fees are charged even if the message failed
+	opStatus := OperationStatusOk
+	for _, fee := range fees {
+		if fee.amount.NilOrZero() {
+			continue
+		}
+		ops = appendOp(ops, fee.opType, sender.String(), fee.amount.Neg().String(), opStatus, false)
+		ops = appendOp(ops, fee.opType, fee.recipient.String(), fee.amount.String(), opStatus, true)
+	}
 
-	// StateCompute includes the messages at height N-1.
-	// So, we're getting the traces of the messages created at N-1, executed at N
-	states, err := (*node).StateCompute(ctx, tipSet.Height(), nil, tipSet.Key())
-	if err != nil {
-		return nil, BuildError(ErrUnableToGetTrace, err, true)
+	return ops
+}
+
+// getBlocksMessages returns the messages included in each block of tipSet, in the same order as its blocks
+func getBlocksMessages(ctx context.Context, node *api.FullNode, tipSet *filTypes.TipSet) ([]*api.BlockMessages, *types.Error) {
+	blocksMsgs := make([]*api.BlockMessages, 0, len(tipSet.Blocks()))
+	for _, block := range tipSet.Blocks() {
+		blockMsgs, err := tools.LotusCall(ctx, lotusCallTimeout(ctx), func(ctx context.Context) (*api.BlockMessages, error) {
+			return (*node).ChainGetBlockMessages(ctx, block.Cid())
+		})
+		if err != nil {
+			return nil, BuildLotusError(ErrUnableToGetTxns, err, true)
+		}
+		blocksMsgs = append(blocksMsgs, blockMsgs)
+	}
+
+	return blocksMsgs, nil
+}
+
+// getMessagesMiners maps the messages included in tipSet, given by getBlocksMessages,
+// to the miner of the first block including them, which is the one rewarded with their tip
+func getMessagesMiners(tipSet *filTypes.TipSet, blocksMsgs []*api.BlockMessages) map[cid.Cid]address.Address {
+	miners := make(map[cid.Cid]address.Address)
+	for i, block := range tipSet.Blocks() {
+		for _, msgCid := range blocksMsgs[i].Cids {
+			if _, ok := miners[msgCid]; !ok {
+				miners[msgCid] = block.Miner
+			}
+		}
 	}
-	return states, nil
+
+	return miners
 }
 
-func (s *BlockAPIService) processTrace(trace *filTypes.ExecutionTrace, operations *[]*types.Operation) {
+// buildTipSetMetadata returns the metadata of the /block response for tipSet. Per block
+// values are listed in the same order as BlockCIDsKey's, and blocksMsgs holds the
+// messages of each block, as returned by getBlocksMessages
+func buildTipSetMetadata(tipSet *filTypes.TipSet, blocksMsgs []*api.BlockMessages) map[string]interface{} {
+	var (
+		blockCIDs     []string
+		miners        []string
+		winCounts     []int64
+		tickets       []string
+		messageCounts []int
+	)
+	for i, block := range tipSet.Blocks() {
+		blockCIDs = append(blockCIDs, block.Cid().String())
+		miners = append(miners, block.Miner.String())
+
+		var winCount int64
+		if block.ElectionProof != nil {
+			winCount = block.ElectionProof.WinCount
+		}
+		winCounts = append(winCounts, winCount)
+
+		var ticket string
+		if block.Ticket != nil {
+			ticket = base64.StdEncoding.EncodeToString(block.Ticket.VRFProof)
+		}
+		tickets = append(tickets, ticket)
+
+		messageCounts = append(messageCounts, len(blocksMsgs[i].Cids))
+	}
+
+	// The parent values are the same for every block in the tipset
+	header := tipSet.Blocks()[0]
+	parentBaseFee := bigOrZero(header.ParentBaseFee)
+	parentWeight := bigOrZero(header.ParentWeight)
+
+	md := make(map[string]interface{})
+	md[BlockCIDsKey] = blockCIDs
+	md[BlockMinersKey] = miners
+	md[BlockWinCountsKey] = winCounts
+	md[BlockTicketsKey] = tickets
+	md[BlockMessageCountsKey] = messageCounts
+	md[ParentBaseFeeKey] = parentBaseFee.String()
+	md[ParentWeightKey] = parentWeight.String()
+	md[ParentStateRootKey] = header.ParentStateRoot.String()
+	md[TipSetKeyKey] = tipSet.Key().String()
+
+	return md
+}
+
+// processTrace analyzes trace recursively, decoding methods and addresses with the actors
+// that existed at tipSet, and appends the resulting operations
+func (s *BlockAPIService) processTrace(ctx context.Context, trace *filTypes.ExecutionTrace, tipSet *filTypes.TipSet, operations *[]*types.Operation) {
+	s.processTraceAs(ctx, trace, tipSet, "", operations)
+}
+
+// processTraceAs is processTrace, with the operations of trace being of type sendType
+// instead of "Send" when given, as for the payouts of a payment channel
+func (s *BlockAPIService) processTraceAs(ctx context.Context, trace *filTypes.ExecutionTrace, tipSet *filTypes.TipSet, sendType string,
+	operations *[]*types.Operation) {
 
 	if trace == nil {
 		return
 	}
 
-	baseMethod, err := GetMethodName(&trace.Msg, s.rosettaLib)
+	baseMethod, err := GetMethodName(ctx, &trace.Msg, s.rosettaLib, tipSet)
 	if err != nil {
 		Logger.Error("could not get method name. Error:", err.Message, err.Details)
 		baseMethod = "unknown"
@@ -250,21 +583,74 @@ func (s *BlockAPIService) processTrace(trace *filTypes.ExecutionTrace, operation
 		opStatus = OperationStatusOk
 	}
 
-	fromPk, err1 := GetActorPubKey(trace.Msg.From, s.rosettaLib)
-	toPk, err2 := GetActorPubKey(trace.Msg.To, s.rosettaLib)
+	fromPk, err1 := GetActorPubKey(ctx, trace.Msg.From, s.rosettaLib, tipSet)
+	toPk, err2 := GetActorPubKey(ctx, trace.Msg.To, s.rosettaLib, tipSet)
 	if err1 != nil || err2 != nil {
 		Logger.Error("could not retrieve one or both pubkeys for addresses:",
 			trace.Msg.From.String(), trace.Msg.To.String())
 		return
 	}
 
+	// Payment channels are created by the init actor calling their constructor
+	if baseMethod == "Constructor" && s.isPaychCreation(ctx, trace, tipSet) {
+		baseMethod = OpPaychCreate
+	}
+
+	// Operation of the multisig Propose or Approve call that executed its transaction, if any
+	var approvalOp *types.OperationIdentifier
+	// Type of the operations of the sends made by this call, when not "Send"
+	subSendType := ""
+
 	switch baseMethod {
 	case "Send", "AddBalance":
 		{
+			opType := baseMethod
+			if baseMethod == "Send" && sendType != "" {
+				opType = sendType
+			}
+			*operations = appendOp(*operations, opType, fromPk,
+				trace.Msg.Value.Neg().String(), opStatus, false)
+			*operations = appendOp(*operations, opType, toPk,
+				trace.Msg.Value.String(), opStatus, true)
+		}
+	case OpPaychCreate:
+		{
+			md, err := decodePaychConstructor(trace.Msg.Params)
+			if err != nil {
+				Logger.Error("Could not parse message params for", baseMethod, err.Error())
+			}
 			*operations = appendOp(*operations, baseMethod, fromPk,
 				trace.Msg.Value.Neg().String(), opStatus, false)
+			(*operations)[len(*operations)-1].Metadata = md
 			*operations = appendOp(*operations, baseMethod, toPk,
 				trace.Msg.Value.String(), opStatus, true)
+			(*operations)[len(*operations)-1].Metadata = md
+		}
+	case "UpdateChannelState":
+		{
+			md, err := decodeVoucher(trace.Msg.Params)
+			if err != nil {
+				Logger.Error("Could not parse message params for", baseMethod, err.Error())
+			}
+			*operations = appendOp(*operations, OpPaychRedeemVoucher, fromPk,
+				trace.Msg.Value.Neg().String(), opStatus, false)
+			(*operations)[len(*operations)-1].Metadata = md
+			*operations = appendOp(*operations, OpPaychRedeemVoucher, toPk,
+				trace.Msg.Value.String(), opStatus, true)
+			(*operations)[len(*operations)-1].Metadata = md
+		}
+	case "Settle", "Collect":
+		{
+			opType := OpPaychSettle
+			if baseMethod == "Collect" {
+				// The channel pays its recipient and refunds its sender with sends
+				opType = OpPaychCollect
+				subSendType = OpPaychCollect
+			}
+			*operations = appendOp(*operations, opType, fromPk,
+				trace.Msg.Value.Neg().String(), opStatus, false)
+			*operations = appendOp(*operations, opType, toPk,
+				trace.Msg.Value.String(), opStatus, true)
 		}
 	case "InvokeContract", "InvokeContractDelegate":
 		{
@@ -282,7 +668,7 @@ func (s *BlockAPIService) processTrace(trace *filTypes.ExecutionTrace, operation
 				trace.Msg.Value.String(), opStatus, true)
 
 			// Check if this Exec op created and funded a msig account
-			params, err := s.parseExecParams(&trace.Msg, &trace.MsgRct)
+			params, err := s.parseExecParams(ctx, &trace.Msg, &trace.MsgRct, tipSet)
 			if err == nil {
 				var paramsMap map[string]string
 				if err := json.Unmarshal([]byte(params), &paramsMap); err == nil {
@@ -299,16 +685,32 @@ func (s *BlockAPIService) processTrace(trace *filTypes.ExecutionTrace, operation
 				}
 			}
 		}
+	case "AwardBlockReward", "ApplyRewards", "OnDeferredCronEvent":
+		{
+			// Rewards and cron-driven payments, from implicit messages
+			if !trace.Msg.Value.NilOrZero() {
+				*operations = appendOp(*operations, baseMethod, fromPk,
+					trace.Msg.Value.Neg().String(), opStatus, false)
+				*operations = appendOp(*operations, baseMethod, toPk,
+					trace.Msg.Value.String(), opStatus, true)
+			}
+		}
 	case "Propose", "Approve", "Cancel":
 		{
+			md, applied := s.multisigTxMetadata(ctx, baseMethod, trace, tipSet)
 			*operations = appendOp(*operations, baseMethod, fromPk,
 				"0", opStatus, false)
+			(*operations)[len(*operations)-1].Metadata = md
 			*operations = appendOp(*operations, baseMethod, toPk,
 				"0", opStatus, true)
+			(*operations)[len(*operations)-1].Metadata = md
+			if applied {
+				approvalOp = (*operations)[len(*operations)-1].OperationIdentifier
+			}
 		}
 	case "SwapSigner":
 		{
-			params, err := s.parseMsigParams(&trace.Msg)
+			params, err := s.parseMsigParams(ctx, &trace.Msg, tipSet)
 			if err == nil {
 				var paramsMap map[string]string
 				if err := json.Unmarshal([]byte(params), &paramsMap); err == nil {
@@ -323,6 +725,19 @@ func (s *BlockAPIService) processTrace(trace *filTypes.ExecutionTrace, operation
 				}
 			}
 		}
+	case "MintExported", "DestroyExported", "TransferExported", "TransferFromExported", "BurnExported", "BurnFromExported":
+		{
+			if !trace.Msg.Value.NilOrZero() {
+				*operations = appendOp(*operations, baseMethod, fromPk,
+					trace.Msg.Value.Neg().String(), opStatus, false)
+				*operations = appendOp(*operations, baseMethod, toPk,
+					trace.Msg.Value.String(), opStatus, true)
+			}
+			// FRC-46 methods of the datacap actor, other actors may export methods with the same number
+			if trace.Msg.To == builtin.DatacapActorAddr {
+				*operations = s.appendDatacapOps(ctx, *operations, baseMethod, trace, opStatus, tipSet)
+			}
+		}
 	default:
 		// We parse here any other transaction type only if Msg.Value != 0
 		if !trace.Msg.Value.NilOrZero() {
@@ -338,14 +753,26 @@ func (s *BlockAPIService) processTrace(trace *filTypes.ExecutionTrace, operation
 	if opStatus == OperationStatusOk {
 		for i := range trace.Subcalls {
 			subTrace := trace.Subcalls[i]
-			s.processTrace(&subTrace, operations)
+			first := len(*operations)
+			if subSendType != "" && subTrace.Msg.From == trace.Msg.To {
+				s.processTraceAs(ctx, &subTrace, tipSet, subSendType, operations)
+			} else {
+				s.processTrace(ctx, &subTrace, tipSet, operations)
+			}
+
+			// Link the executed send to the proposal or approval that authorized it
+			if approvalOp != nil && isExecutedSend(trace, &subTrace) && len(*operations) > first {
+				sendOp := (*operations)[first]
+				sendOp.RelatedOperations = append(sendOp.RelatedOperations, approvalOp)
+				approvalOp = nil
+			}
 		}
 	}
 }
 
-func (s *BlockAPIService) parseExecParams(msg *filTypes.MessageTrace, receipt *filTypes.ReturnTrace) (string, error) {
+func (s *BlockAPIService) parseExecParams(ctx context.Context, msg *filTypes.MessageTrace, receipt *filTypes.ReturnTrace, tipSet *filTypes.TipSet) (string, error) {
 
-	actorName := GetActorNameFromAddress(msg.To, s.rosettaLib)
+	actorName := GetActorNameFromAddress(ctx, msg.To, s.rosettaLib, tipSet)
 
 	switch actorName {
 	case "init":
@@ -382,14 +809,14 @@ func (s *BlockAPIService) parseExecParams(msg *filTypes.MessageTrace, receipt *f
 	}
 }
 
-func (s *BlockAPIService) parseMsigParams(msg *filTypes.MessageTrace) (string, error) {
+func (s *BlockAPIService) parseMsigParams(ctx context.Context, msg *filTypes.MessageTrace, tipSet *filTypes.TipSet) (string, error) {
 	msgSerial, err := json.Marshal(msg)
 	if err != nil {
 		Logger.Error("Could not parse params. Cannot serialize lotus message:", err.Error())
 		return "", err
 	}
 
-	actorCode, err := tools.ActorsDB.GetActorCode(msg.To)
+	actorCode, err := tools.ActorsDB.GetActorCode(ctx, msg.To, tipSet)
 	if err != nil {
 		return "", err
 	}
@@ -441,5 +868,94 @@ func (s *BlockAPIService) BlockTransaction(
 	ctx context.Context,
 	request *types.BlockTransactionRequest,
 ) (*types.BlockTransactionResponse, *types.Error) {
-	return nil, ErrNotImplemented
+	ctx = withEndpoint(ctx, BlockTransactionEndpoint)
+
+	if request.BlockIdentifier == nil || request.TransactionIdentifier == nil {
+		return nil, BuildError(ErrInsufficientQueryInputs, nil, true)
+	}
+
+	errNet := ValidateNetworkId(ctx, &s.node, request.NetworkIdentifier)
+	if errNet != nil {
+		return nil, errNet
+	}
+
+	requestedHeight := request.BlockIdentifier.Index
+	if requestedHeight < 0 {
+		return nil, BuildError(ErrMalformedValue, nil, true)
+	}
+
+	requestedHash := request.TransactionIdentifier.Hash
+	if !strings.HasPrefix(requestedHash, ImplicitTxPrefix) {
+		if _, err := cid.Parse(requestedHash); err != nil {
+			return nil, BuildError(ErrMalformedValue, err, true)
+		}
+	}
+
+	// Check sync status
+	status, syncErr := CheckSyncStatus(ctx, &s.node)
+	if syncErr != nil {
+		return nil, syncErr
+	}
+	if requestedHeight > 0 && !status.IsSynced() {
+		return nil, BuildError(ErrUnableToGetUnsyncedBlock, nil, true)
+	}
+
+	tipSet, err := tools.LotusCall(ctx, lotusCallTimeout(ctx), func(ctx context.Context) (*filTypes.TipSet, error) {
+		return s.node.ChainGetTipSetByHeight(ctx, abi.ChainEpoch(requestedHeight), filTypes.EmptyTSK)
+	})
+	if err != nil {
+		return nil, BuildLotusError(ErrUnableToGetTipset, err, true)
+	}
+
+	// A null round cannot contain any transaction
+	if int64(tipSet.Height()) != requestedHeight {
+		return nil, BuildError(ErrTransactionNotFound, nil, true)
+	}
+
+	tipSetKeyHash, encErr := BuildTipSetKeyHash(tipSet.Key())
+	if encErr != nil {
+		return nil, BuildError(ErrUnableToBuildTipSetHash, encErr, true)
+	}
+	if *tipSetKeyHash != request.BlockIdentifier.Hash {
+		return nil, BuildError(ErrInvalidHash, nil, true)
+	}
+
+	// Transactions are only built for heights > 1, see Block
+	if requestedHeight <= 1 {
+		return nil, BuildError(ErrTransactionNotFound, nil, true)
+	}
+
+	blocksMsgs, blocksMsgsErr := getBlocksMessages(ctx, &s.node, tipSet)
+	if blocksMsgsErr != nil {
+		return nil, blocksMsgsErr
+	}
+	miners := getMessagesMiners(tipSet, blocksMsgs)
+
+	states, source, stateErr := s.getTraces(ctx, tipSet, blocksMsgs, abi.ChainEpoch(status.GetMaxHeight()))
+	if stateErr != nil {
+		return nil, stateErr
+	}
+
+	txHashes := traceTxHashes(states, tipSet.Height())
+	for i := range states.Trace {
+		if txHashes[i] == "" || txHashes[i] != requestedHash {
+			continue
+		}
+
+		transfers, transfersErr := s.getTokenTransfers(ctx, &api.ComputeStateOutput{Trace: states.Trace[i : i+1]})
+		if transfersErr != nil {
+			return nil, transfersErr
+		}
+		transaction := s.buildTransaction(ctx, states.Trace[i], txHashes[i], tipSet, miners, transfers[states.Trace[i].MsgCid])
+		if transaction == nil {
+			break
+		}
+		markUntracedSubcalls([]*types.Transaction{transaction}, source)
+
+		return &types.BlockTransactionResponse{
+			Transaction: transaction,
+		}, nil
+	}
+
+	return nil, BuildError(ErrTransactionNotFound, nil, true)
 }
@@ -0,0 +1,125 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/coinbase/rosetta-sdk-go/types"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/lotus/api"
+	filTypes "github.com/filecoin-project/lotus/chain/types"
+	lru "github.com/hashicorp/golang-lru/v2"
+	"github.com/zondax/rosetta-filecoin-proxy/rosetta/tools"
+)
+
+// BlockHashIndex is set on startup when indexing the hashes of tipsets is enabled
+var BlockHashIndex *TipSetHashIndex
+
+// TipSetHashIndex keeps the height of tipsets by their hash, as given by BuildTipSetKeyHash,
+// so blocks can be requested by hash only. The hash can't be reversed, so tipsets are indexed
+// as they're served and by walking the chain from its head in the background, see Backfill.
+type TipSetHashIndex struct {
+	heights *lru.Cache[string, abi.ChainEpoch]
+}
+
+func NewTipSetHashIndex(capacity int) *TipSetHashIndex {
+	heights, _ := lru.New[string, abi.ChainEpoch](capacity)
+	return &TipSetHashIndex{heights: heights}
+}
+
+// Add indexes the tipset with the given hash at height. It does nothing on a nil index.
+func (i *TipSetHashIndex) Add(hash string, height abi.ChainEpoch) {
+	if i == nil {
+		return
+	}
+	i.heights.Add(hash, height)
+}
+
+// Height returns the height of the tipset with the given hash, if indexed
+func (i *TipSetHashIndex) Height(hash string) (abi.ChainEpoch, bool) {
+	if i == nil {
+		return 0, false
+	}
+	return i.heights.Get(hash)
+}
+
+// Backfill indexes the tipsets up to depth epochs below the chain's head, then follows
+// the head every interval until ctx is done
+func (i *TipSetHashIndex) Backfill(ctx context.Context, node api.FullNode, depth int, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// Height of the head indexed by the last complete walk
+	synced := abi.ChainEpoch(-1)
+	for {
+		head, err := i.backfill(ctx, node, depth, synced)
+		if err != nil {
+			Logger.Debugf("could not backfill block hash index: %s", err.Error())
+		} else {
+			synced = head
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// backfill walks the chain from its head down to depth epochs below it, stopping at the
+// tipsets indexed by the previous walk up to synced, and returns the height of the head.
+// After a reorg the walk goes on until the common ancestor.
+func (i *TipSetHashIndex) backfill(ctx context.Context, node api.FullNode, depth int, synced abi.ChainEpoch) (abi.ChainEpoch, error) {
+	defer TimeTrack(time.Now(), "[Proxy]BlockHashIndexBackfill")
+
+	ctx = withEndpoint(ctx, BlockEndpoint)
+	head, err := tools.LotusCall(ctx, lotusCallTimeout(ctx), func(ctx context.Context) (*filTypes.TipSet, error) {
+		return node.ChainHead(ctx)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	lowest := head.Height() - abi.ChainEpoch(depth)
+	tipSet := head
+	for {
+		hash, err := BuildTipSetKeyHash(tipSet.Key())
+		if err != nil {
+			return 0, err
+		}
+		if _, ok := i.Height(*hash); ok && tipSet.Height() <= synced {
+			break
+		}
+		i.Add(*hash, tipSet.Height())
+
+		if tipSet.Height() <= lowest || tipSet.Parents().IsEmpty() {
+			break
+		}
+		tipSet, err = tools.LotusCall(ctx, lotusCallTimeout(ctx), func(ctx context.Context) (*filTypes.TipSet, error) {
+			return node.ChainGetTipSet(ctx, tipSet.Parents())
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return head.Height(), nil
+}
+
+// resolveBlockHeight returns the height of the block identified by id,
+// looking its hash up in BlockHashIndex when the index isn't given
+func resolveBlockHeight(id *types.PartialBlockIdentifier) (int64, *types.Error) {
+	if id.Index != nil {
+		return *id.Index, nil
+	}
+	if id.Hash == nil {
+		return 0, BuildError(ErrInsufficientQueryInputs, nil, true)
+	}
+
+	height, ok := BlockHashIndex.Height(*id.Hash)
+	if !ok {
+		return 0, BuildError(ErrBlockHashNotIndexed, nil, true)
+	}
+	return int64(height), nil
+}
@@ -0,0 +1,168 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/coinbase/rosetta-sdk-go/types"
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/crypto"
+	"github.com/filecoin-project/lotus/api"
+	filTypes "github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/node/modules/dtypes"
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/mock"
+	mocks "github.com/zondax/rosetta-filecoin-proxy/rosetta/services/mocks"
+)
+
+// buildMockChain returns the tipsets of a chain up to height, each one the parent of the next
+func buildMockChain(height int64) []*filTypes.TipSet {
+	mockCid, _ := cid.Parse("bafkqaaa")
+	mockMiner, _ := address.NewFromString("t00")
+
+	var chain []*filTypes.TipSet
+	var parents []cid.Cid
+	for h := int64(0); h <= height; h++ {
+		tipSet, _ := filTypes.NewTipSet([]*filTypes.BlockHeader{
+			{
+				Miner:                 mockMiner,
+				Height:                abi.ChainEpoch(h),
+				Parents:               parents,
+				ParentStateRoot:       mockCid,
+				Messages:              mockCid,
+				ParentMessageReceipts: mockCid,
+				BlockSig:              &crypto.Signature{Type: crypto.SigTypeBLS},
+				BLSAggregate:          &crypto.Signature{Type: crypto.SigTypeBLS},
+			},
+		})
+		chain = append(chain, tipSet)
+		parents = tipSet.Cids()
+	}
+	return chain
+}
+
+func TestTipSetHashIndexBackfill(t *testing.T) {
+	chain := buildMockChain(102)
+	head := chain[100]
+
+	nodeMock := mocks.FullNode{}
+	nodeMock.On("ChainHead", mock.Anything).
+		Return(func(ctx context.Context) *filTypes.TipSet {
+			return head
+		}, nil)
+	nodeMock.On("ChainGetTipSet", mock.Anything, mock.Anything).
+		Return(func(ctx context.Context, key filTypes.TipSetKey) *filTypes.TipSet {
+			for _, tipSet := range chain {
+				if tipSet.Key() == key {
+					return tipSet
+				}
+			}
+			return nil
+		}, nil)
+
+	index := NewTipSetHashIndex(10)
+	synced, err := index.backfill(context.Background(), &nodeMock, 3, -1)
+	if err != nil {
+		t.Fatalf("backfill() error = %v", err)
+	}
+	if synced != 100 {
+		t.Errorf("backfill() got = %d, want 100", synced)
+	}
+	for h, tipSet := range chain {
+		hash, _ := BuildTipSetKeyHash(tipSet.Key())
+		height, ok := index.Height(*hash)
+		wantOk := h >= 97 && h <= 100
+		if ok != wantOk || (ok && height != abi.ChainEpoch(h)) {
+			t.Errorf("Height() of tipset at %d got = %d, %v", h, height, ok)
+		}
+	}
+	nodeMock.AssertNumberOfCalls(t, "ChainGetTipSet", 3)
+
+	// The next walk stops at the tipsets already indexed
+	head = chain[102]
+	if _, err = index.backfill(context.Background(), &nodeMock, 3, synced); err != nil {
+		t.Fatalf("backfill() error = %v", err)
+	}
+	nodeMock.AssertNumberOfCalls(t, "ChainGetTipSet", 5)
+
+	BlockHashIndex = index
+	defer func() { BlockHashIndex = nil }()
+
+	hash, _ := BuildTipSetKeyHash(chain[101].Key())
+	height, heightErr := resolveBlockHeight(&types.PartialBlockIdentifier{Hash: hash})
+	if heightErr != nil || height != 101 {
+		t.Errorf("resolveBlockHeight() got = %d, %v, want 101", height, heightErr)
+	}
+	hash, _ = BuildTipSetKeyHash(chain[90].Key())
+	if _, heightErr = resolveBlockHeight(&types.PartialBlockIdentifier{Hash: hash}); heightErr != ErrBlockHashNotIndexed {
+		t.Errorf("resolveBlockHeight() error = %v, want %v", heightErr, ErrBlockHashNotIndexed)
+	}
+}
+
+func TestAccountBalanceChecksIndexedHash(t *testing.T) {
+	chain := buildMockChain(102)
+
+	// A tipset at height 100 reverted by a reorg, still in the index
+	reverted := buildMockChain(100)[100]
+	reverted.Blocks()[0].Timestamp = 1
+	reverted, _ = filTypes.NewTipSet(reverted.Blocks())
+	revertedHash, _ := BuildTipSetKeyHash(reverted.Key())
+
+	BlockHashIndex = NewTipSetHashIndex(10)
+	defer func() { BlockHashIndex = nil }()
+	BlockHashIndex.Add(*revertedHash, reverted.Height())
+
+	nodeMock := mocks.FullNode{}
+	nodeMock.On("StateNetworkName", mock.Anything).
+		Return(dtypes.NetworkName(NetworkID.Network), nil)
+	nodeMock.On("SyncState", mock.Anything).
+		Return(&api.SyncState{
+			ActiveSyncs: []api.ActiveSync{
+				{
+					Stage:  api.StageSyncComplete,
+					Target: &filTypes.TipSet{},
+				},
+			},
+		}, nil)
+	nodeMock.On("ChainHead", mock.Anything).
+		Return(chain[102], nil)
+	nodeMock.On("ChainGetTipSetByHeight", mock.Anything, mock.Anything, mock.Anything).
+		Return(func(ctx context.Context, height abi.ChainEpoch, tsk filTypes.TipSetKey) *filTypes.TipSet {
+			return chain[height]
+		}, nil)
+
+	s := &AccountAPIService{network: NetworkID, node: &nodeMock}
+	_, err := s.AccountBalance(context.Background(), &types.AccountBalanceRequest{
+		NetworkIdentifier: NetworkID,
+		AccountIdentifier: &types.AccountIdentifier{Address: "f01000"},
+		BlockIdentifier:   &types.PartialBlockIdentifier{Hash: revertedHash},
+	})
+	if err != ErrInvalidHash {
+		t.Errorf("AccountBalance() error = %v, want %v", err, ErrInvalidHash)
+	}
+	nodeMock.AssertNotCalled(t, "StateGetActor", mock.Anything, mock.Anything, mock.Anything)
+
+	// The balance at the head is answered with the head's parent, as the state of its messages
+	nodeMock.On("ChainGetTipSet", mock.Anything, chain[102].Parents()).
+		Return(chain[101], nil)
+	nodeMock.On("StateGetActor", mock.Anything, mock.Anything, mock.Anything).
+		Return(nil, fmt.Errorf("actor not found"))
+	headHash, _ := BuildTipSetKeyHash(chain[102].Key())
+	BlockHashIndex.Add(*headHash, chain[102].Height())
+	var headIndex int64 = 102
+	for _, id := range []*types.PartialBlockIdentifier{{Index: &headIndex, Hash: headHash}, {Hash: headHash}} {
+		resp, err := s.AccountBalance(context.Background(), &types.AccountBalanceRequest{
+			NetworkIdentifier: NetworkID,
+			AccountIdentifier: &types.AccountIdentifier{Address: "f01000"},
+			BlockIdentifier:   id,
+		})
+		if err != nil {
+			t.Fatalf("AccountBalance() by the head's hash error = %v", err)
+		}
+		if resp.BlockIdentifier.Index != 101 {
+			t.Errorf("AccountBalance() by the head's hash got block %d, want 101", resp.BlockIdentifier.Index)
+		}
+	}
+}
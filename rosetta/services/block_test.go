@@ -1,7 +1,9 @@
 package services
 
 import (
+	"bytes"
 	"context"
+	"fmt"
 	"reflect"
 	"testing"
 
@@ -9,13 +11,18 @@ import (
 	"github.com/coinbase/rosetta-sdk-go/types"
 	"github.com/filecoin-project/go-address"
 	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/builtin"
+	"github.com/filecoin-project/go-state-types/builtin/v17/reward"
 	"github.com/filecoin-project/go-state-types/crypto"
+	"github.com/filecoin-project/go-state-types/exitcode"
 	"github.com/filecoin-project/lotus/api"
 	filTypes "github.com/filecoin-project/lotus/chain/types"
 	"github.com/filecoin-project/lotus/node/modules/dtypes"
 	"github.com/ipfs/go-cid"
 	"github.com/stretchr/testify/mock"
+	"github.com/zondax/rosetta-filecoin-lib/actors"
 	mocks "github.com/zondax/rosetta-filecoin-proxy/rosetta/services/mocks"
+	"github.com/zondax/rosetta-filecoin-proxy/rosetta/tools"
 )
 
 var NetworkID = &types.NetworkIdentifier{
@@ -30,8 +37,7 @@ func TestBlockAPIService_Block(t *testing.T) {
 	// Mock needed input arguments
 	var requestedIndex int64 = 0
 	requestedHash := "0171a0e40220bb47c05c217eae793e828a9f5a48713470bf811cda2cb32f186c842d6af1d4e9"
-	mockMetadata := make(map[string]interface{})
-	mockMetadata[BlockCIDsKey] = []string{"bafy2bzacebpqu5wuaddffscppacgu2cxk75skzldo45atrhwbnl4fnvb2l75m"}
+	unknownHash := "0171a0e40220bb47c05c217eae793e828a9f5a48713470bf811cda2cb32f186c842d6af1d4ea"
 	mockCid, _ := cid.Parse("bafkqaaa")
 	mockMiner, _ := address.NewFromString("t00")
 	mockTipSet, _ := filTypes.NewTipSet([]*filTypes.BlockHeader{
@@ -46,6 +52,16 @@ func TestBlockAPIService_Block(t *testing.T) {
 		},
 	},
 	)
+	mockMetadata := make(map[string]interface{})
+	mockMetadata[BlockCIDsKey] = []string{"bafy2bzacebpqu5wuaddffscppacgu2cxk75skzldo45atrhwbnl4fnvb2l75m"}
+	mockMetadata[BlockMinersKey] = []string{mockMiner.String()}
+	mockMetadata[BlockWinCountsKey] = []int64{0}
+	mockMetadata[BlockTicketsKey] = []string{""}
+	mockMetadata[BlockMessageCountsKey] = []int{2}
+	mockMetadata[ParentBaseFeeKey] = "0"
+	mockMetadata[ParentWeightKey] = "0"
+	mockMetadata[ParentStateRootKey] = mockCid.String()
+	mockMetadata[TipSetKeyKey] = mockTipSet.Key().String()
 	///
 
 	// Mock functions
@@ -63,6 +79,8 @@ func TestBlockAPIService_Block(t *testing.T) {
 			nil)
 	nodeMock.On("ChainGetTipSetByHeight", mock.Anything, mock.Anything, mock.Anything).
 		Return(mockTipSet, nil)
+	nodeMock.On("ChainGetBlockMessages", mock.Anything, mock.Anything).
+		Return(&api.BlockMessages{Cids: []cid.Cid{mockCid, mockCid}}, nil)
 	nodeMock.On("ChainGetParentMessages", mock.Anything, mock.Anything).
 		Return([]api.Message{}, nil)
 
@@ -121,8 +139,48 @@ func TestBlockAPIService_Block(t *testing.T) {
 			want:  responseTest1,
 			want1: nil,
 		},
+		{
+			// The hash is indexed by the previous request
+			name: "RetrieveGenesisTipSetByHash",
+			fields: fields{
+				network: NetworkID,
+				node:    &nodeMock,
+			},
+			args: args{
+				ctx: context.Background(),
+				request: &types.BlockRequest{
+					NetworkIdentifier: NetworkID,
+					BlockIdentifier: &types.PartialBlockIdentifier{
+						Hash: &requestedHash,
+					},
+				},
+			},
+			want:  responseTest1,
+			want1: nil,
+		},
+		{
+			name: "RetrieveByUnknownHash",
+			fields: fields{
+				network: NetworkID,
+				node:    &nodeMock,
+			},
+			args: args{
+				ctx: context.Background(),
+				request: &types.BlockRequest{
+					NetworkIdentifier: NetworkID,
+					BlockIdentifier: &types.PartialBlockIdentifier{
+						Hash: &unknownHash,
+					},
+				},
+			},
+			want:  nil,
+			want1: ErrBlockHashNotIndexed,
+		},
 	}
 
+	BlockHashIndex = NewTipSetHashIndex(10)
+	defer func() { BlockHashIndex = nil }()
+
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			s := &BlockAPIService{
@@ -141,6 +199,149 @@ func TestBlockAPIService_Block(t *testing.T) {
 }
 
 func TestBlockAPIService_BlockTransaction(t *testing.T) {
+
+	nodeMock := mocks.FullNode{}
+
+	// Mock needed input arguments
+	var requestedIndex int64 = 100
+	mockTipSet := buildMockTargetTipSet(requestedIndex)
+	mockTipSetHash, _ := BuildTipSetKeyHash(mockTipSet.Key())
+	mockFrom, _ := address.NewFromString("t01001")
+	mockTo, _ := address.NewFromString("t01002")
+	mockMsg := &filTypes.Message{
+		From:  mockFrom,
+		To:    mockTo,
+		Value: abi.NewTokenAmount(100),
+	}
+	mockMsgCid := mockMsg.Cid()
+	mockUnknownCid, _ := cid.Parse("bafy2bzacebpqu5wuaddffscppacgu2cxk75skzldo45atrhwbnl4fnvb2l75m")
+	mockRewardMiner, _ := address.NewFromString("t01000")
+	mockRewardParams := &reward.AwardBlockRewardParams{
+		Miner:     mockRewardMiner,
+		Penalty:   abi.NewTokenAmount(0),
+		GasReward: abi.NewTokenAmount(3),
+		WinCount:  1,
+	}
+	mockRewardParamsBuf := new(bytes.Buffer)
+	_ = mockRewardParams.MarshalCBOR(mockRewardParamsBuf)
+	mockRewardMsg := &filTypes.Message{
+		From:   builtin.SystemActorAddr,
+		To:     builtin.RewardActorAddr,
+		Nonce:  uint64(requestedIndex),
+		Method: builtin.MethodsReward.AwardBlockReward,
+		Params: mockRewardParamsBuf.Bytes(),
+	}
+	mockStates := &api.ComputeStateOutput{
+		Trace: []*api.InvocResult{
+			{
+				MsgCid: mockMsgCid,
+				Msg:    mockMsg,
+				GasCost: api.MsgGasCost{
+					BaseFeeBurn:        abi.NewTokenAmount(7),
+					OverEstimationBurn: abi.NewTokenAmount(0),
+					MinerTip:           abi.NewTokenAmount(3),
+					TotalCost:          abi.NewTokenAmount(10),
+				},
+				ExecutionTrace: filTypes.ExecutionTrace{
+					Msg: filTypes.MessageTrace{
+						From:  mockFrom,
+						To:    mockTo,
+						Value: abi.NewTokenAmount(100),
+					},
+				},
+			},
+			{
+				MsgCid: mockRewardMsg.Cid(),
+				Msg:    mockRewardMsg,
+				ExecutionTrace: filTypes.ExecutionTrace{
+					Msg: filTypes.MessageTrace{
+						From:   mockRewardMsg.From,
+						To:     mockRewardMsg.To,
+						Value:  abi.NewTokenAmount(0),
+						Method: mockRewardMsg.Method,
+						Params: mockRewardMsg.Params,
+					},
+					Subcalls: []filTypes.ExecutionTrace{
+						{
+							Msg: filTypes.MessageTrace{
+								From:   builtin.RewardActorAddr,
+								To:     mockRewardMiner,
+								Value:  abi.NewTokenAmount(53),
+								Method: builtin.MethodsMiner.ApplyRewards,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	///
+
+	// Mock functions
+	nodeMock.On("StateNetworkName", mock.Anything).
+		Return(dtypes.NetworkName(NetworkID.Network), nil)
+	nodeMock.On("SyncState", mock.Anything).
+		Return(&api.SyncState{
+			ActiveSyncs: []api.ActiveSync{
+				{
+					Stage:  api.StageSyncComplete,
+					Target: &filTypes.TipSet{},
+				},
+			},
+		},
+			nil)
+	nodeMock.On("ChainGetTipSetByHeight", mock.Anything, mock.Anything, mock.Anything).
+		Return(mockTipSet, nil)
+	nodeMock.On("StateCompute", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Return(mockStates, nil)
+	nodeMock.On("StateGetActor", mock.Anything, mock.Anything, mock.Anything).
+		Return(nil, fmt.Errorf("actor not found"))
+	nodeMock.On("ChainGetBlockMessages", mock.Anything, mock.Anything).
+		Return(&api.BlockMessages{Cids: []cid.Cid{mockMsgCid}}, nil)
+	///
+
+	var db tools.Database = &tools.Cache{}
+	var node api.FullNode = &nodeMock
+	db.NewImpl(&node)
+	tools.ActorsDB = db
+
+	// Output
+	opStatus := OperationStatusOk
+	var expectedOps []*types.Operation
+	expectedOps = appendOp(expectedOps, "Send", mockFrom.String(), "-100", opStatus, false)
+	expectedOps = appendOp(expectedOps, "Send", mockTo.String(), "100", opStatus, true)
+	expectedOps = appendOp(expectedOps, OpBaseFeeBurn, mockFrom.String(), "-7", opStatus, false)
+	expectedOps = appendOp(expectedOps, OpBaseFeeBurn, "f099", "7", opStatus, true)
+	expectedOps = appendOp(expectedOps, OpMinerTip, mockFrom.String(), "-3", opStatus, false)
+	expectedOps = appendOp(expectedOps, OpMinerTip, mockTipSet.Blocks()[0].Miner.String(), "3", opStatus, true)
+
+	var responseTest1 = &types.BlockTransactionResponse{
+		Transaction: &types.Transaction{
+			TransactionIdentifier: &types.TransactionIdentifier{
+				Hash: mockMsgCid.String(),
+			},
+			Operations: expectedOps,
+		},
+	}
+
+	// The gas reward was already credited to the miner as tips
+	var expectedRewardOps []*types.Operation
+	expectedRewardOps = appendOp(expectedRewardOps, "unknown", builtin.RewardActorAddr.String(), "-50", opStatus, false)
+	expectedRewardOps = appendOp(expectedRewardOps, "unknown", mockRewardMiner.String(), "50", opStatus, true)
+
+	var responseTest2 = &types.BlockTransactionResponse{
+		Transaction: &types.Transaction{
+			TransactionIdentifier: &types.TransactionIdentifier{
+				Hash: ImplicitTxHash(abi.ChainEpoch(requestedIndex), 0),
+			},
+			Operations: expectedRewardOps,
+			Metadata: map[string]interface{}{
+				ImplicitMethodKey: actors.UnknownStr,
+			},
+		},
+	}
+	///
+
 	type fields struct {
 		network *types.NetworkIdentifier
 		node    api.FullNode
@@ -156,7 +357,94 @@ func TestBlockAPIService_BlockTransaction(t *testing.T) {
 		want   *types.BlockTransactionResponse
 		want1  *types.Error
 	}{
-		// TODO: Add test cases.
+		{
+			name: "RetrieveTransaction",
+			fields: fields{
+				network: NetworkID,
+				node:    &nodeMock,
+			},
+			args: args{
+				ctx: context.Background(),
+				request: &types.BlockTransactionRequest{
+					NetworkIdentifier: NetworkID,
+					BlockIdentifier: &types.BlockIdentifier{
+						Index: requestedIndex,
+						Hash:  *mockTipSetHash,
+					},
+					TransactionIdentifier: &types.TransactionIdentifier{
+						Hash: mockMsgCid.String(),
+					},
+				},
+			},
+			want:  responseTest1,
+			want1: nil,
+		},
+		{
+			name: "RetrieveImplicitTransaction",
+			fields: fields{
+				network: NetworkID,
+				node:    &nodeMock,
+			},
+			args: args{
+				ctx: context.Background(),
+				request: &types.BlockTransactionRequest{
+					NetworkIdentifier: NetworkID,
+					BlockIdentifier: &types.BlockIdentifier{
+						Index: requestedIndex,
+						Hash:  *mockTipSetHash,
+					},
+					TransactionIdentifier: &types.TransactionIdentifier{
+						Hash: ImplicitTxHash(abi.ChainEpoch(requestedIndex), 0),
+					},
+				},
+			},
+			want:  responseTest2,
+			want1: nil,
+		},
+		{
+			name: "TransactionNotInBlock",
+			fields: fields{
+				network: NetworkID,
+				node:    &nodeMock,
+			},
+			args: args{
+				ctx: context.Background(),
+				request: &types.BlockTransactionRequest{
+					NetworkIdentifier: NetworkID,
+					BlockIdentifier: &types.BlockIdentifier{
+						Index: requestedIndex,
+						Hash:  *mockTipSetHash,
+					},
+					TransactionIdentifier: &types.TransactionIdentifier{
+						Hash: mockUnknownCid.String(),
+					},
+				},
+			},
+			want:  nil,
+			want1: ErrTransactionNotFound,
+		},
+		{
+			name: "InvalidBlockHash",
+			fields: fields{
+				network: NetworkID,
+				node:    &nodeMock,
+			},
+			args: args{
+				ctx: context.Background(),
+				request: &types.BlockTransactionRequest{
+					NetworkIdentifier: NetworkID,
+					BlockIdentifier: &types.BlockIdentifier{
+						Index: requestedIndex,
+						Hash:  "invalid",
+					},
+					TransactionIdentifier: &types.TransactionIdentifier{
+						Hash: mockMsgCid.String(),
+					},
+				},
+			},
+			want:  nil,
+			want1: ErrInvalidHash,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -175,6 +463,50 @@ func TestBlockAPIService_BlockTransaction(t *testing.T) {
 	}
 }
 
+func TestBlockSummary(t *testing.T) {
+	mockFrom, _ := address.NewFromString("t01001")
+	mockTo, _ := address.NewFromString("t01002")
+	mockTrace := func(value int64, exitCode exitcode.ExitCode) *api.InvocResult {
+		return &api.InvocResult{
+			Msg: &filTypes.Message{
+				From:     mockFrom,
+				To:       mockTo,
+				Value:    abi.NewTokenAmount(value),
+				GasLimit: 1000,
+			},
+			MsgRct: &filTypes.MessageReceipt{
+				ExitCode: exitCode,
+				GasUsed:  600,
+			},
+			GasCost: api.MsgGasCost{
+				BaseFeeBurn:        abi.NewTokenAmount(7),
+				OverEstimationBurn: abi.NewTokenAmount(2),
+				MinerTip:           abi.NewTokenAmount(3),
+				TotalCost:          abi.NewTokenAmount(12),
+			},
+		}
+	}
+
+	summary := newBlockSummary()
+	summary.add(mockTrace(100, exitcode.Ok))
+	summary.add(mockTrace(50, exitcode.SysErrInsufficientFunds))
+
+	want := &BlockSummary{
+		TotalFees:          abi.NewTokenAmount(24),
+		BaseFeeBurn:        abi.NewTokenAmount(14),
+		OverEstimationBurn: abi.NewTokenAmount(4),
+		MinerTips:          abi.NewTokenAmount(6),
+		ValueTransferred:   abi.NewTokenAmount(100),
+		Messages:           2,
+		FailedMessages:     1,
+		GasUsed:            1200,
+		GasLimit:           2000,
+	}
+	if !reflect.DeepEqual(summary, want) {
+		t.Errorf("BlockSummary = %+v, want %+v", summary, want)
+	}
+}
+
 func TestNewBlockAPIService(t *testing.T) {
 	type args struct {
 		network *types.NetworkIdentifier
@@ -1,5 +1,7 @@
 package services
 
+import "time"
+
 var (
 	// Versions info to be injected on build time
 	RosettaSDKVersion = "Unknown"
@@ -14,6 +16,22 @@ var (
 
 	// Network name (read from api in main)
 	NetworkName = ""
+
+	// TimeOut for RPC Lotus calls of endpoints without their own, see LotusCallTimeOuts
+	LotusCallTimeOut = DefaultLotusCallTimeOut
+
+	// Blocks computed in the background after a /block request, 0 disables prefetching
+	BlockPrefetchDepth = 0
+	// Max number of blocks computed at the same time in the background
+	BlockPrefetchConcurrency = DefaultBlockPrefetchConcurrency
+	// Source of the execution traces of blocks, one of TraceSources or TraceSourceAuto
+	TraceSource = TraceSourceAuto
+	// Epochs below the chain's head a tipset must be to keep its StateCompute output in tools.StateCache
+	StateCacheFinalityDepth = DefaultStateCacheFinalityDepth
+	// Tipset served as the chain's head, one of SafeHeadModes
+	SafeHeadMode = SafeHeadModeOff
+	// Epochs below the chain's head the safe head is, with SafeHeadModeDepth
+	SafeHeadDepth = 0
 )
 
 const (
@@ -23,6 +41,8 @@ const (
 	// Currency
 	CurrencySymbol   = "FIL"
 	CurrencyDecimals = 18
+	DatacapSymbol    = "DATACAP"
+	DatacapDecimals  = 18
 
 	// Operation status
 	OperationStatusOk     = "Ok"
@@ -37,19 +57,58 @@ const (
 	VestingUnlockDurationKey = "UnlockDuration"
 	VestingInitialBalanceKey = "InitialBalance"
 
+	// Storage miner account
+	AvailableBalanceStr  = "AvailableBalance"
+	VestingFundsStr      = "VestingFunds"
+	InitialPledgeStr     = "InitialPledge"
+	PreCommitDepositsStr = "PreCommitDeposits"
+	FeeDebtStr           = "FeeDebt"
+
+	// Lotus
+	DefaultLotusCallTimeOut = 60 * 4 * time.Second // TimeOut for RPC Lotus calls
+
+	// Block
+	DefaultBlockPrefetchConcurrency = 2
+	DefaultStateCacheFinalityDepth  = int(ECFinality)
+
+	// Block hash index
+	DefaultBlockHashIndexCapacity         = 100000
+	DefaultBlockHashIndexBackfillDepth    = 2880 // One day of epochs
+	DefaultBlockHashIndexBackfillInterval = 30 * time.Second
+
 	// Misc
-	ProxyLoggerName = "rosetta-filecoin-proxy"
+	ProxyLoggerName     = "rosetta-filecoin-proxy"
+	DefaultActorsDBPath = "actors.db"
+)
+
+// Fee operations
+const (
+	OpBaseFeeBurn        = "BaseFeeBurn"
+	OpOverEstimationBurn = "OverEstimationBurn"
+	OpMinerTip           = "MinerTip"
 )
 
 // Supported operations
 var SupportedOperations = map[string]bool{
 	"Send":                   true, // Common
-	"Fee":                    true, // Common
+	OpBaseFeeBurn:            true, // Common
+	OpOverEstimationBurn:     true, // Common
+	OpMinerTip:               true, // Common
+	OpERC20Transfer:          true, // EVM events
+	OpERC20Mint:              true, // EVM events
+	OpERC20Burn:              true, // EVM events
+	OpDatacapMint:            true, // MethodsDatacap
+	OpDatacapTransfer:        true, // MethodsDatacap
+	OpDatacapBurn:            true, // MethodsDatacap
 	"Exec":                   true, // MethodsInit
 	"SwapSigner":             true, // MethodsMultisig
 	"Propose":                true, // MethodsMultisig
 	"Approve":                true, // MethodsMultisig
 	"Cancel":                 true, // MethodsMultisig
+	OpPaychCreate:            true, // MethodsPaych
+	OpPaychRedeemVoucher:     true, // MethodsPaych
+	OpPaychSettle:            true, // MethodsPaych
+	OpPaychCollect:           true, // MethodsPaych
 	"AwardBlockReward":       true, // MethodsReward
 	"OnDeferredCronEvent":    true, // MethodsMiner
 	"PreCommitSector":        true, // MethodsMiner
@@ -3,18 +3,26 @@ package services
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/coinbase/rosetta-sdk-go/server"
 	"github.com/coinbase/rosetta-sdk-go/types"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
 	"github.com/filecoin-project/go-address"
 	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/builtin"
+	"github.com/filecoin-project/go-state-types/crypto"
 	"github.com/filecoin-project/lotus/api"
 	"github.com/filecoin-project/lotus/build"
 	filTypes "github.com/filecoin-project/lotus/chain/types"
 	"github.com/filecoin-project/lotus/chain/types/ethtypes"
+	"github.com/ipfs/go-cid"
+	"github.com/minio/blake2b-simd"
 	filLib "github.com/zondax/rosetta-filecoin-lib"
 	"github.com/zondax/rosetta-filecoin-lib/actors"
+	"github.com/zondax/rosetta-filecoin-proxy/rosetta/tools"
 	"regexp"
+	"strconv"
 )
 
 // ChainIDKey is the name of the key in the Options map inside a
@@ -79,6 +87,8 @@ func (c *ConstructionAPIService) ConstructionMetadata(
 	ctx context.Context,
 	request *types.ConstructionMetadataRequest,
 ) (*types.ConstructionMetadataResponse, *types.Error) {
+	ctx = withEndpoint(ctx, ConstructionMetadataEndpoint)
+
 	var (
 		addressSenderParsed   address.Address
 		addressReceiverParsed address.Address
@@ -93,6 +103,10 @@ func (c *ConstructionAPIService) ConstructionMetadata(
 		}
 	)
 
+	if c.node == nil {
+		return nil, ErrOfflineMode
+	}
+
 	errNet := ValidateNetworkId(ctx, &c.node, request.NetworkIdentifier)
 	if errNet != nil {
 		return nil, errNet
@@ -128,7 +142,10 @@ func (c *ConstructionAPIService) ConstructionMetadata(
 			message.To = addressReceiverParsed
 
 			// Get receiver's actor code
-			receiverActor, errAct := c.node.StateGetActor(context.Background(), addressReceiverParsed, filTypes.EmptyTSK)
+			receiverActor, errAct := c.getActor(ctx, addressReceiverParsed)
+			if errors.Is(errAct, tools.ErrCallTimedOut) {
+				return nil, BuildLotusError(ErrUnableToGetActor, errAct, true)
+			}
 			if errAct != nil {
 				// Actor not found on chain, set an empty field
 				md[DestinationActorIdKey] = ""
@@ -148,46 +165,54 @@ func (c *ConstructionAPIService) ConstructionMetadata(
 		}
 
 		if okSender {
-			nonce, err = c.node.MpoolGetNonce(ctx, addressSenderParsed)
+			nonce, err = tools.LotusCall(ctx, lotusCallTimeout(ctx), func(ctx context.Context) (uint64, error) {
+				return c.node.MpoolGetNonce(ctx, addressSenderParsed)
+			})
 			if err != nil {
-				return nil, BuildError(ErrUnableToGetNextNonce, err, true)
+				return nil, BuildLotusError(ErrUnableToGetNextNonce, err, true)
 			}
 			md[NonceKey] = nonce
 
 			// Get available balance
-			actor, errAct := c.node.StateGetActor(context.Background(), addressSenderParsed, filTypes.EmptyTSK)
+			actor, errAct := c.getActor(ctx, addressSenderParsed)
 			if errAct != nil {
-				return nil, BuildError(ErrUnableToGetActor, errAct, true)
+				return nil, BuildLotusError(ErrUnableToGetActor, errAct, true)
 			}
 
 			if c.rosettaLib.BuiltinActors.IsActor(actor.Code, actors.ActorMultisigName) {
 				// Get the unlocked funds of the multisig account
-				availableFunds, err = c.node.MsigGetAvailableBalance(ctx, addressSenderParsed, filTypes.EmptyTSK)
+				availableFunds, err = tools.LotusCall(ctx, lotusCallTimeout(ctx), func(ctx context.Context) (filTypes.BigInt, error) {
+					return c.node.MsigGetAvailableBalance(ctx, addressSenderParsed, filTypes.EmptyTSK)
+				})
 				if err != nil {
-					return nil, BuildError(ErrUnableToGetBalance, err, true)
+					return nil, BuildLotusError(ErrUnableToGetBalance, err, true)
 				}
 			} else {
 				availableFunds = actor.Balance
 			}
 
 			// GasEstimateMessageGas to get a safely overestimated value for gas limit
-			message, err = c.node.GasEstimateMessageGas(ctx, message,
-				&api.MessageSendSpec{MaxFee: filTypes.NewInt(uint64(build.BlockGasLimit))}, filTypes.TipSetKey{})
+			message, err = tools.LotusCall(ctx, lotusCallTimeout(ctx), func(ctx context.Context) (*filTypes.Message, error) {
+				return c.node.GasEstimateMessageGas(ctx, message,
+					&api.MessageSendSpec{MaxFee: filTypes.NewInt(uint64(build.BlockGasLimit))}, filTypes.TipSetKey{})
+			})
 			if err != nil {
-				return nil, BuildError(ErrUnableToEstimateGasLimit, err, true)
+				return nil, BuildLotusError(ErrUnableToEstimateGasLimit, err, true)
 			}
 
 			// GasEstimateGasPremium
-			gasPremium, gasErr := c.node.GasEstimateGasPremium(ctx, blockInclUint, addressSenderParsed, message.GasLimit, filTypes.TipSetKey{})
+			gasPremium, gasErr := c.estimateGasPremium(ctx, blockInclUint, addressSenderParsed, message.GasLimit)
 			if gasErr != nil {
-				return nil, BuildError(ErrUnableToEstimateGasPremium, gasErr, true)
+				return nil, BuildLotusError(ErrUnableToEstimateGasPremium, gasErr, true)
 			}
 			message.GasPremium = gasPremium
 
 			// GasEstimateFeeCap requires gasPremium to be set on message
-			gasFeeCap, gasErr := c.node.GasEstimateFeeCap(ctx, message, int64(blockInclUint), filTypes.TipSetKey{})
+			gasFeeCap, gasErr := tools.LotusCall(ctx, lotusCallTimeout(ctx), func(ctx context.Context) (filTypes.BigInt, error) {
+				return c.node.GasEstimateFeeCap(ctx, message, int64(blockInclUint), filTypes.TipSetKey{})
+			})
 			if gasErr != nil {
-				return nil, BuildError(ErrUnableToEstimateGasFeeCap, gasErr, true)
+				return nil, BuildLotusError(ErrUnableToEstimateGasFeeCap, gasErr, true)
 			}
 			message.GasFeeCap = gasFeeCap
 
@@ -201,9 +226,9 @@ func (c *ConstructionAPIService) ConstructionMetadata(
 			}
 		} else {
 			// We can only estimate gas premium without a sender address
-			gasPremium, gasErr := c.node.GasEstimateGasPremium(ctx, blockInclUint, address.Address{}, message.GasLimit, filTypes.TipSetKey{})
+			gasPremium, gasErr := c.estimateGasPremium(ctx, blockInclUint, address.Address{}, message.GasLimit)
 			if gasErr != nil {
-				return nil, BuildError(ErrUnableToEstimateGasPremium, gasErr, true)
+				return nil, BuildLotusError(ErrUnableToEstimateGasPremium, gasErr, true)
 			}
 			message.GasPremium = gasPremium
 		}
@@ -226,6 +251,11 @@ func (c *ConstructionAPIService) ConstructionSubmit(
 	ctx context.Context,
 	request *types.ConstructionSubmitRequest,
 ) (*types.TransactionIdentifierResponse, *types.Error) {
+	ctx = withEndpoint(ctx, ConstructionSubmitEndpoint)
+
+	if c.node == nil {
+		return nil, ErrOfflineMode
+	}
 
 	if request.SignedTransaction == "" {
 		return nil, BuildError(ErrMalformedValue, nil, true)
@@ -249,20 +279,35 @@ func (c *ConstructionAPIService) ConstructionSubmit(
 		return nil, BuildError(ErrMalformedValue, nil, true)
 	}
 
-	cid, errTx := c.node.MpoolPush(ctx, &signedTx)
+	msgCid, errTx := tools.LotusCall(ctx, lotusCallTimeout(ctx), func(ctx context.Context) (cid.Cid, error) {
+		return c.node.MpoolPush(ctx, &signedTx)
+	})
 	if errTx != nil {
-		return nil, BuildError(ErrUnableToSubmitTx, errTx, true)
+		return nil, BuildLotusError(ErrUnableToSubmitTx, errTx, true)
 	}
 
 	resp := &types.TransactionIdentifierResponse{
 		TransactionIdentifier: &types.TransactionIdentifier{
-			Hash: cid.String(),
+			Hash: msgCid.String(),
 		},
 	}
 
 	return resp, nil
 }
 
+func (c *ConstructionAPIService) getActor(ctx context.Context, add address.Address) (*filTypes.Actor, error) {
+	return tools.LotusCall(ctx, lotusCallTimeout(ctx), func(ctx context.Context) (*filTypes.Actor, error) {
+		return c.node.StateGetActor(ctx, add, filTypes.EmptyTSK)
+	})
+}
+
+func (c *ConstructionAPIService) estimateGasPremium(ctx context.Context, blockIncl uint64,
+	sender address.Address, gasLimit int64) (filTypes.BigInt, error) {
+	return tools.LotusCall(ctx, lotusCallTimeout(ctx), func(ctx context.Context) (filTypes.BigInt, error) {
+		return c.node.GasEstimateGasPremium(ctx, blockIncl, sender, gasLimit, filTypes.TipSetKey{})
+	})
+}
+
 func (c *ConstructionAPIService) parseAddress(add string) (address.Address, error) {
 	if ok := IsEthereumAddress(add); ok {
 		filCid, err := EthereumAddressToFilecoin(add)
@@ -312,26 +357,417 @@ func EthereumAddressFromHex(add string) (ethtypes.EthAddress, error) {
 	return ethAdd, nil
 }
 
-func (c *ConstructionAPIService) ConstructionCombine(ctx context.Context, request *types.ConstructionCombineRequest) (*types.ConstructionCombineResponse, *types.Error) {
-	return nil, ErrNotImplemented
+// ConstructionDerive implements the /construction/derive endpoint.
+func (c *ConstructionAPIService) ConstructionDerive(
+	ctx context.Context,
+	request *types.ConstructionDeriveRequest,
+) (*types.ConstructionDeriveResponse, *types.Error) {
+
+	errNet := ValidateNetworkIdOffline(c.network, request.NetworkIdentifier)
+	if errNet != nil {
+		return nil, errNet
+	}
+
+	if request.PublicKey == nil || request.PublicKey.CurveType != types.Secp256k1 {
+		return nil, BuildError(ErrMalformedValue, nil, true)
+	}
+
+	// Filecoin addresses are derived from the uncompressed public key
+	pubKey, err := secp256k1.ParsePubKey(request.PublicKey.Bytes)
+	if err != nil {
+		return nil, BuildError(ErrUnableToDeriveAddress, err, true)
+	}
+
+	// Use the same address prefix as the rest of the proxy's responses
+	derivedAddress, err := c.rosettaLib.DeriveFromPublicKey(pubKey.SerializeUncompressed(), address.CurrentNetwork)
+	if err != nil {
+		return nil, BuildError(ErrUnableToDeriveAddress, err, true)
+	}
+
+	resp := &types.ConstructionDeriveResponse{
+		AccountIdentifier: &types.AccountIdentifier{
+			Address: derivedAddress,
+		},
+	}
+
+	return resp, nil
 }
 
-func (c *ConstructionAPIService) ConstructionDerive(ctx context.Context, request *types.ConstructionDeriveRequest) (*types.ConstructionDeriveResponse, *types.Error) {
-	return nil, ErrNotImplemented
+// ConstructionPreprocess implements the /construction/preprocess endpoint.
+func (c *ConstructionAPIService) ConstructionPreprocess(
+	ctx context.Context,
+	request *types.ConstructionPreprocessRequest,
+) (*types.ConstructionPreprocessResponse, *types.Error) {
+
+	errNet := ValidateNetworkIdOffline(c.network, request.NetworkIdentifier)
+	if errNet != nil {
+		return nil, errNet
+	}
+
+	sender, receiver, value, errOps := parseSendOperations(request.Operations)
+	if errOps != nil {
+		return nil, errOps
+	}
+
+	options := make(map[string]interface{})
+	options[OptionsSenderIDKey] = sender
+	options[OptionsReceiverIDKey] = receiver
+	options[OptionsValueKey] = value
+
+	// Forward the optional inclusion delay to /construction/metadata
+	if blockIncl, ok := request.Metadata[OptionsBlockInclKey]; ok {
+		options[OptionsBlockInclKey] = blockIncl
+	}
+
+	resp := &types.ConstructionPreprocessResponse{
+		Options: options,
+		RequiredPublicKeys: []*types.AccountIdentifier{
+			{
+				Address: sender,
+			},
+		},
+	}
+
+	return resp, nil
 }
 
-func (c *ConstructionAPIService) ConstructionHash(ctx context.Context, request *types.ConstructionHashRequest) (*types.TransactionIdentifierResponse, *types.Error) {
-	return nil, ErrNotImplemented
+// ConstructionPayloads implements the /construction/payloads endpoint.
+func (c *ConstructionAPIService) ConstructionPayloads(
+	ctx context.Context,
+	request *types.ConstructionPayloadsRequest,
+) (*types.ConstructionPayloadsResponse, *types.Error) {
+
+	errNet := ValidateNetworkIdOffline(c.network, request.NetworkIdentifier)
+	if errNet != nil {
+		return nil, errNet
+	}
+
+	sender, receiver, value, errOps := parseSendOperations(request.Operations)
+	if errOps != nil {
+		return nil, errOps
+	}
+
+	nonce, err := parseUintMetadata(request.Metadata, NonceKey)
+	if err != nil {
+		return nil, BuildError(ErrMalformedValue, err, true)
+	}
+
+	gasLimit, err := parseUintMetadata(request.Metadata, GasLimitKey)
+	if err != nil {
+		return nil, BuildError(ErrMalformedValue, err, true)
+	}
+
+	gasPremium, okPremium := request.Metadata[GasPremiumKey].(string)
+	gasFeeCap, okFeeCap := request.Metadata[GasFeeCapKey].(string)
+	if !okPremium || !okFeeCap {
+		return nil, BuildError(ErrMalformedValue, nil, true)
+	}
+
+	paymentRequest := &filLib.PaymentRequest{
+		From:     sender,
+		To:       receiver,
+		Quantity: value,
+		Metadata: filLib.TxMetadata{
+			Nonce:      nonce,
+			GasPremium: gasPremium,
+			GasFeeCap:  gasFeeCap,
+			GasLimit:   int64(gasLimit),
+		},
+	}
+
+	unsignedTx, err := c.rosettaLib.ConstructPayment(paymentRequest)
+	if err != nil {
+		return nil, BuildError(ErrUnableToConstructTx, err, true)
+	}
+
+	message, err := unmarshalMessage(unsignedTx)
+	if err != nil {
+		return nil, BuildError(ErrUnableToConstructTx, err, true)
+	}
+
+	resp := &types.ConstructionPayloadsResponse{
+		UnsignedTransaction: unsignedTx,
+		Payloads: []*types.SigningPayload{
+			{
+				AccountIdentifier: &types.AccountIdentifier{
+					Address: sender,
+				},
+				Bytes:         buildSigningPayload(message),
+				SignatureType: types.EcdsaRecovery,
+			},
+		},
+	}
+
+	return resp, nil
 }
 
-func (c *ConstructionAPIService) ConstructionParse(ctx context.Context, request *types.ConstructionParseRequest) (*types.ConstructionParseResponse, *types.Error) {
-	return nil, ErrNotImplemented
+// ConstructionCombine implements the /construction/combine endpoint.
+func (c *ConstructionAPIService) ConstructionCombine(
+	ctx context.Context,
+	request *types.ConstructionCombineRequest,
+) (*types.ConstructionCombineResponse, *types.Error) {
+
+	errNet := ValidateNetworkIdOffline(c.network, request.NetworkIdentifier)
+	if errNet != nil {
+		return nil, errNet
+	}
+
+	if len(request.Signatures) != 1 || request.Signatures[0] == nil {
+		return nil, BuildError(ErrInvalidSignature, nil, true)
+	}
+
+	signature := request.Signatures[0]
+	if signature.SignatureType != types.EcdsaRecovery {
+		return nil, BuildError(ErrInvalidSignature, nil, true)
+	}
+
+	message, err := unmarshalMessage(request.UnsignedTransaction)
+	if err != nil {
+		return nil, BuildError(ErrMalformedTx, err, true)
+	}
+
+	signedTx := &filTypes.SignedMessage{
+		Message: *message,
+		Signature: crypto.Signature{
+			Type: crypto.SigTypeSecp256k1,
+			Data: signature.Bytes,
+		},
+	}
+
+	signedTxJSON, err := json.Marshal(signedTx)
+	if err != nil {
+		return nil, BuildError(ErrMalformedTx, err, true)
+	}
+
+	// Hash verifies the signature against the sender's address
+	_, err = c.rosettaLib.Hash(string(signedTxJSON))
+	if err != nil {
+		return nil, BuildError(ErrInvalidSignature, err, true)
+	}
+
+	resp := &types.ConstructionCombineResponse{
+		SignedTransaction: string(signedTxJSON),
+	}
+
+	return resp, nil
+}
+
+// ConstructionParse implements the /construction/parse endpoint.
+func (c *ConstructionAPIService) ConstructionParse(
+	ctx context.Context,
+	request *types.ConstructionParseRequest,
+) (*types.ConstructionParseResponse, *types.Error) {
+
+	errNet := ValidateNetworkIdOffline(c.network, request.NetworkIdentifier)
+	if errNet != nil {
+		return nil, errNet
+	}
+
+	var (
+		message *filTypes.Message
+		signers []*types.AccountIdentifier
+		err     error
+	)
+
+	if request.Signed {
+		var signedTx filTypes.SignedMessage
+		err = json.Unmarshal([]byte(request.Transaction), &signedTx)
+		if err != nil {
+			return nil, BuildError(ErrMalformedTx, err, true)
+		}
+		message = &signedTx.Message
+		signers = []*types.AccountIdentifier{
+			{
+				Address: message.From.String(),
+			},
+		}
+	} else {
+		message, err = unmarshalMessage(request.Transaction)
+		if err != nil {
+			return nil, BuildError(ErrMalformedTx, err, true)
+		}
+	}
+
+	// Only transfers can be shown as operations, other methods would be mistaken for them
+	if !isTransferMessage(message) {
+		return nil, BuildError(ErrOperationNotSupported, fmt.Errorf("method %d is not Send", message.Method), true)
+	}
+
+	md := make(map[string]interface{})
+	md[NonceKey] = message.Nonce
+	md[GasLimitKey] = message.GasLimit
+	md[GasPremiumKey] = message.GasPremium.String()
+	md[GasFeeCapKey] = message.GasFeeCap.String()
+
+	resp := &types.ConstructionParseResponse{
+		Operations:               buildSendOperations(message.From.String(), message.To.String(), message.Value),
+		AccountIdentifierSigners: signers,
+		Metadata:                 md,
+	}
+
+	return resp, nil
+}
+
+// isTransferMessage tells whether message only transfers its value, as built by /construction/payloads:
+// a Send, or an InvokeContract without params to an f410 address, which is how FIL is sent to EVM actors
+func isTransferMessage(message *filTypes.Message) bool {
+	if message.Method == builtin.MethodSend {
+		return true
+	}
+	return message.Method == builtin.MethodsEVM.InvokeContract && len(message.Params) == 0 &&
+		message.To.Protocol() == address.Delegated
+}
+
+// ConstructionHash implements the /construction/hash endpoint.
+func (c *ConstructionAPIService) ConstructionHash(
+	ctx context.Context,
+	request *types.ConstructionHashRequest,
+) (*types.TransactionIdentifierResponse, *types.Error) {
+
+	errNet := ValidateNetworkIdOffline(c.network, request.NetworkIdentifier)
+	if errNet != nil {
+		return nil, errNet
+	}
+
+	if request.SignedTransaction == "" {
+		return nil, BuildError(ErrMalformedValue, nil, true)
+	}
+
+	hash, err := c.rosettaLib.Hash(request.SignedTransaction)
+	if err != nil {
+		return nil, BuildError(ErrMalformedTx, err, true)
+	}
+
+	resp := &types.TransactionIdentifierResponse{
+		TransactionIdentifier: &types.TransactionIdentifier{
+			Hash: hash,
+		},
+	}
+
+	return resp, nil
+}
+
+// parseSendOperations validates a pair of "Send" operations (a debit from the sender
+// and the matching credit to the receiver) and returns sender, receiver and value
+func parseSendOperations(operations []*types.Operation) (string, string, string, *types.Error) {
+	if len(operations) != 2 {
+		return "", "", "", BuildError(ErrInvalidOperations, nil, true)
+	}
+
+	var sender, receiver string
+	var value filTypes.BigInt
+	for _, op := range operations {
+		if op == nil || op.Type != METHOD_SEND || op.Account == nil || op.Amount == nil {
+			return "", "", "", BuildError(ErrInvalidOperations, nil, true)
+		}
+
+		if op.Amount.Currency == nil || op.Amount.Currency.Symbol != CurrencySymbol ||
+			op.Amount.Currency.Decimals != CurrencyDecimals {
+			return "", "", "", BuildError(ErrInvalidOperations, nil, true)
+		}
+
+		amount, err := filTypes.BigFromString(op.Amount.Value)
+		if err != nil {
+			return "", "", "", BuildError(ErrInvalidOperations, err, true)
+		}
+
+		if amount.Sign() < 0 {
+			sender = op.Account.Address
+		} else {
+			receiver = op.Account.Address
+			value = amount
+		}
+	}
+
+	if sender == "" || receiver == "" {
+		return "", "", "", BuildError(ErrInvalidOperations, nil, true)
+	}
+
+	// Both operations must move the same amount
+	debit, _ := filTypes.BigFromString(operations[0].Amount.Value)
+	credit, _ := filTypes.BigFromString(operations[1].Amount.Value)
+	if filTypes.BigAdd(debit, credit).Sign() != 0 {
+		return "", "", "", BuildError(ErrInvalidOperations, nil, true)
+	}
+
+	return sender, receiver, value.String(), nil
 }
 
-func (c *ConstructionAPIService) ConstructionPayloads(ctx context.Context, request *types.ConstructionPayloadsRequest) (*types.ConstructionPayloadsResponse, *types.Error) {
-	return nil, ErrNotImplemented
+// buildSendOperations returns the operations describing a "Send" transaction,
+// without status as required for construction responses
+func buildSendOperations(sender string, receiver string, value filTypes.BigInt) []*types.Operation {
+	return []*types.Operation{
+		{
+			OperationIdentifier: &types.OperationIdentifier{
+				Index: 0,
+			},
+			Type: METHOD_SEND,
+			Account: &types.AccountIdentifier{
+				Address: sender,
+			},
+			Amount: &types.Amount{
+				Value:    value.Neg().String(),
+				Currency: GetCurrencyData(),
+			},
+		},
+		{
+			OperationIdentifier: &types.OperationIdentifier{
+				Index: 1,
+			},
+			RelatedOperations: []*types.OperationIdentifier{
+				{
+					Index: 0,
+				},
+			},
+			Type: METHOD_SEND,
+			Account: &types.AccountIdentifier{
+				Address: receiver,
+			},
+			Amount: &types.Amount{
+				Value:    value.String(),
+				Currency: GetCurrencyData(),
+			},
+		},
+	}
 }
 
-func (c *ConstructionAPIService) ConstructionPreprocess(ctx context.Context, request *types.ConstructionPreprocessRequest) (*types.ConstructionPreprocessResponse, *types.Error) {
-	return nil, ErrNotImplemented
+// buildSigningPayload returns the digest that must be signed for a message, that
+// is the blake2b-256 hash of the message's CID
+func buildSigningPayload(message *filTypes.Message) []byte {
+	digest := blake2b.Sum256(message.Cid().Bytes())
+	return digest[:]
+}
+
+func unmarshalMessage(unsignedTx string) (*filTypes.Message, error) {
+	var message filTypes.Message
+	err := json.Unmarshal([]byte(unsignedTx), &message)
+	if err != nil {
+		return nil, err
+	}
+
+	return &message, nil
+}
+
+// parseUintMetadata reads a numeric value from metadata, which can be either a
+// native integer or a float64 / string when it comes from a JSON request
+func parseUintMetadata(md map[string]interface{}, key string) (uint64, error) {
+	raw, ok := md[key]
+	if !ok {
+		return 0, fmt.Errorf("missing '%s' in metadata", key)
+	}
+
+	switch value := raw.(type) {
+	case float64:
+		return uint64(value), nil
+	case int64:
+		return uint64(value), nil
+	case uint64:
+		return value, nil
+	case int:
+		return uint64(value), nil
+	case string:
+		return strconv.ParseUint(value, 10, 64)
+	default:
+		return 0, fmt.Errorf("invalid type for '%s' in metadata", key)
+	}
 }
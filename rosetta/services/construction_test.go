@@ -2,9 +2,15 @@ package services
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"github.com/coinbase/rosetta-sdk-go/server"
 	"github.com/coinbase/rosetta-sdk-go/types"
+	gocrypto "github.com/filecoin-project/go-crypto"
+	"github.com/filecoin-project/go-state-types/builtin"
 	"github.com/filecoin-project/lotus/api"
+	filTypes "github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/chain/types/ethtypes"
 	"reflect"
 	"testing"
 )
@@ -99,3 +105,171 @@ func TestNewConstructionAPIService(t *testing.T) {
 		})
 	}
 }
+
+func TestConstructionAPIService_ConstructionFlow(t *testing.T) {
+	c := &ConstructionAPIService{
+		network:    NetworkID,
+		rosettaLib: rosettaLib,
+	}
+	ctx := context.Background()
+
+	sk, err := base64.StdEncoding.DecodeString("8VcW07ADswS4BV2cxi5rnIadVsyTDDhY1NfDH19T8Uo=")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pk := gocrypto.PublicKey(sk)
+
+	// Derive
+	deriveResp, rosettaErr := c.ConstructionDerive(ctx, &types.ConstructionDeriveRequest{
+		NetworkIdentifier: NetworkID,
+		PublicKey: &types.PublicKey{
+			Bytes:     pk,
+			CurveType: types.Secp256k1,
+		},
+	})
+	if rosettaErr != nil {
+		t.Fatalf("ConstructionDerive() error = %v", rosettaErr)
+	}
+	sender := deriveResp.AccountIdentifier.Address
+	receiver := "f137sjdbgunloi7couiy4l5nc7pd6k2jmq32vizpy"
+	operations := buildSendOperations(sender, receiver, filTypes.NewInt(100000))
+
+	// Preprocess
+	preprocessResp, rosettaErr := c.ConstructionPreprocess(ctx, &types.ConstructionPreprocessRequest{
+		NetworkIdentifier: NetworkID,
+		Operations:        operations,
+	})
+	if rosettaErr != nil {
+		t.Fatalf("ConstructionPreprocess() error = %v", rosettaErr)
+	}
+	if preprocessResp.Options[OptionsSenderIDKey] != sender ||
+		preprocessResp.Options[OptionsReceiverIDKey] != receiver ||
+		preprocessResp.Options[OptionsValueKey] != "100000" {
+		t.Errorf("ConstructionPreprocess() got options = %v", preprocessResp.Options)
+	}
+
+	// Payloads
+	md := make(map[string]interface{})
+	md[NonceKey] = float64(1)
+	md[GasLimitKey] = float64(2500000)
+	md[GasPremiumKey] = "100000"
+	md[GasFeeCapKey] = "200000"
+	payloadsResp, rosettaErr := c.ConstructionPayloads(ctx, &types.ConstructionPayloadsRequest{
+		NetworkIdentifier: NetworkID,
+		Operations:        operations,
+		Metadata:          md,
+	})
+	if rosettaErr != nil {
+		t.Fatalf("ConstructionPayloads() error = %v", rosettaErr)
+	}
+	if len(payloadsResp.Payloads) != 1 {
+		t.Fatalf("ConstructionPayloads() got %d payloads, want 1", len(payloadsResp.Payloads))
+	}
+
+	// Parse unsigned
+	parseResp, rosettaErr := c.ConstructionParse(ctx, &types.ConstructionParseRequest{
+		NetworkIdentifier: NetworkID,
+		Signed:            false,
+		Transaction:       payloadsResp.UnsignedTransaction,
+	})
+	if rosettaErr != nil {
+		t.Fatalf("ConstructionParse() error = %v", rosettaErr)
+	}
+	if !reflect.DeepEqual(parseResp.Operations, operations) {
+		t.Errorf("ConstructionParse() got = %v, want %v", parseResp.Operations, operations)
+	}
+
+	// Only sends can be parsed
+	var proposeMsg filTypes.Message
+	if err = json.Unmarshal([]byte(payloadsResp.UnsignedTransaction), &proposeMsg); err != nil {
+		t.Fatal(err)
+	}
+	proposeMsg.Method = builtin.MethodsMultisig.Propose
+	proposeTx, _ := json.Marshal(&proposeMsg)
+	_, rosettaErr = c.ConstructionParse(ctx, &types.ConstructionParseRequest{
+		NetworkIdentifier: NetworkID,
+		Signed:            false,
+		Transaction:       string(proposeTx),
+	})
+	if rosettaErr == nil || rosettaErr.Code != ErrOperationNotSupported.Code {
+		t.Errorf("ConstructionParse() error = %v, want %v", rosettaErr, ErrOperationNotSupported)
+	}
+
+	// Transfers to f410 addresses are built as calls to InvokeContract, and parsed back as sends
+	evmReceiver, _ := ethtypes.ParseEthAddress("0x1111111111111111111111111111111111111111")
+	evmReceiverAddr, _ := evmReceiver.ToFilecoinAddress()
+	evmOperations := buildSendOperations(sender, evmReceiverAddr.String(), filTypes.NewInt(100000))
+	evmPayloadsResp, rosettaErr := c.ConstructionPayloads(ctx, &types.ConstructionPayloadsRequest{
+		NetworkIdentifier: NetworkID,
+		Operations:        evmOperations,
+		Metadata:          md,
+	})
+	if rosettaErr != nil {
+		t.Fatalf("ConstructionPayloads() error = %v", rosettaErr)
+	}
+	parseResp, rosettaErr = c.ConstructionParse(ctx, &types.ConstructionParseRequest{
+		NetworkIdentifier: NetworkID,
+		Signed:            false,
+		Transaction:       evmPayloadsResp.UnsignedTransaction,
+	})
+	if rosettaErr != nil {
+		t.Fatalf("ConstructionParse() of a transfer to %s error = %v", evmReceiverAddr, rosettaErr)
+	}
+	if !reflect.DeepEqual(parseResp.Operations, evmOperations) {
+		t.Errorf("ConstructionParse() got = %v, want %v", parseResp.Operations, evmOperations)
+	}
+
+	// Sign and combine
+	signature, err := gocrypto.Sign(sk, payloadsResp.Payloads[0].Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	combineResp, rosettaErr := c.ConstructionCombine(ctx, &types.ConstructionCombineRequest{
+		NetworkIdentifier:   NetworkID,
+		UnsignedTransaction: payloadsResp.UnsignedTransaction,
+		Signatures: []*types.Signature{
+			{
+				SigningPayload: payloadsResp.Payloads[0],
+				PublicKey: &types.PublicKey{
+					Bytes:     pk,
+					CurveType: types.Secp256k1,
+				},
+				SignatureType: types.EcdsaRecovery,
+				Bytes:         signature,
+			},
+		},
+	})
+	if rosettaErr != nil {
+		t.Fatalf("ConstructionCombine() error = %v", rosettaErr)
+	}
+
+	// Parse signed
+	parseResp, rosettaErr = c.ConstructionParse(ctx, &types.ConstructionParseRequest{
+		NetworkIdentifier: NetworkID,
+		Signed:            true,
+		Transaction:       combineResp.SignedTransaction,
+	})
+	if rosettaErr != nil {
+		t.Fatalf("ConstructionParse() error = %v", rosettaErr)
+	}
+	if len(parseResp.AccountIdentifierSigners) != 1 || parseResp.AccountIdentifierSigners[0].Address != sender {
+		t.Errorf("ConstructionParse() got signers = %v, want %s", parseResp.AccountIdentifierSigners, sender)
+	}
+
+	// Hash
+	hashResp, rosettaErr := c.ConstructionHash(ctx, &types.ConstructionHashRequest{
+		NetworkIdentifier: NetworkID,
+		SignedTransaction: combineResp.SignedTransaction,
+	})
+	if rosettaErr != nil {
+		t.Fatalf("ConstructionHash() error = %v", rosettaErr)
+	}
+
+	var signedTx filTypes.SignedMessage
+	if err = json.Unmarshal([]byte(combineResp.SignedTransaction), &signedTx); err != nil {
+		t.Fatal(err)
+	}
+	if hashResp.TransactionIdentifier.Hash != signedTx.Cid().String() {
+		t.Errorf("ConstructionHash() got = %s, want %s", hashResp.TransactionIdentifier.Hash, signedTx.Cid().String())
+	}
+}
@@ -0,0 +1,169 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/coinbase/rosetta-sdk-go/types"
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/filecoin-project/go-state-types/builtin"
+	"github.com/filecoin-project/go-state-types/builtin/v17/datacap"
+	"github.com/filecoin-project/lotus/api"
+	filTypes "github.com/filecoin-project/lotus/chain/types"
+	"github.com/zondax/rosetta-filecoin-proxy/rosetta/tools"
+)
+
+// Datacap operations, built from the FRC-46 methods of the datacap actor
+const (
+	OpDatacapMint     = "DatacapMint"
+	OpDatacapTransfer = "DatacapTransfer"
+	OpDatacapBurn     = "DatacapBurn"
+)
+
+func GetDatacapCurrencyData() *types.Currency {
+	return &types.Currency{
+		Symbol:   DatacapSymbol,
+		Decimals: DatacapDecimals,
+		Metadata: nil,
+	}
+}
+
+// datacapMovement is the datacap moved by a call to the datacap actor. from is address.Undef
+// for mints, and to for burns, as the datacap actor holds no datacap itself.
+type datacapMovement struct {
+	opType string
+	from   address.Address
+	to     address.Address
+	amount abi.TokenAmount
+}
+
+// decodeDatacapMovement decodes the params of a call to the datacap actor method
+// method. caller is the actor that made the call.
+func decodeDatacapMovement(method string, caller address.Address, params []byte) (*datacapMovement, error) {
+	reader := bytes.NewReader(params)
+
+	switch method {
+	case "MintExported":
+		var p datacap.MintParams
+		if err := p.UnmarshalCBOR(reader); err != nil {
+			return nil, err
+		}
+		return &datacapMovement{OpDatacapMint, address.Undef, p.To, p.Amount}, nil
+	case "TransferExported":
+		var p datacap.TransferParams
+		if err := p.UnmarshalCBOR(reader); err != nil {
+			return nil, err
+		}
+		return &datacapMovement{OpDatacapTransfer, caller, p.To, p.Amount}, nil
+	case "TransferFromExported":
+		// The caller is an operator allowed to spend From's datacap
+		var p datacap.TransferFromParams
+		if err := p.UnmarshalCBOR(reader); err != nil {
+			return nil, err
+		}
+		return &datacapMovement{OpDatacapTransfer, p.From, p.To, p.Amount}, nil
+	case "BurnExported":
+		var p datacap.BurnParams
+		if err := p.UnmarshalCBOR(reader); err != nil {
+			return nil, err
+		}
+		return &datacapMovement{OpDatacapBurn, caller, address.Undef, p.Amount}, nil
+	case "BurnFromExported":
+		var p datacap.BurnFromParams
+		if err := p.UnmarshalCBOR(reader); err != nil {
+			return nil, err
+		}
+		return &datacapMovement{OpDatacapBurn, p.Owner, address.Undef, p.Amount}, nil
+	case "DestroyExported":
+		// Called by the verified registry to remove datacap from a client
+		var p datacap.DestroyParams
+		if err := p.UnmarshalCBOR(reader); err != nil {
+			return nil, err
+		}
+		return &datacapMovement{OpDatacapBurn, p.Owner, address.Undef, p.Amount}, nil
+	default:
+		return nil, nil
+	}
+}
+
+// appendDatacapOps appends the operations of the datacap moved by a call to the datacap actor.
+// Mints and burns have a single operation, like those of tokens.
+func (s *BlockAPIService) appendDatacapOps(ctx context.Context, ops []*types.Operation, method string, trace *filTypes.ExecutionTrace,
+	status string, tipSet *filTypes.TipSet) []*types.Operation {
+	movement, err := decodeDatacapMovement(method, trace.Msg.From, trace.Msg.Params)
+	if err != nil {
+		Logger.Error("Could not parse message params for", method, err.Error())
+		return ops
+	}
+	if movement == nil || movement.amount.NilOrZero() {
+		return ops
+	}
+
+	var fromPk, toPk string
+	var err1, err2 *types.Error
+	if movement.from != address.Undef {
+		fromPk, err1 = GetActorPubKey(ctx, movement.from, s.rosettaLib, tipSet)
+	}
+	if movement.to != address.Undef {
+		toPk, err2 = GetActorPubKey(ctx, movement.to, s.rosettaLib, tipSet)
+	}
+	if err1 != nil || err2 != nil {
+		Logger.Error("could not retrieve one or both pubkeys for addresses:",
+			movement.from.String(), movement.to.String())
+		return ops
+	}
+
+	currency := GetDatacapCurrencyData()
+	if movement.from != address.Undef {
+		ops = appendOp(ops, movement.opType, fromPk, movement.amount.Neg().String(), status, false)
+		ops[len(ops)-1].Amount.Currency = currency
+	}
+	if movement.to != address.Undef {
+		ops = appendOp(ops, movement.opType, toPk, movement.amount.String(), status, movement.from != address.Undef)
+		ops[len(ops)-1].Amount.Currency = currency
+	}
+
+	return ops
+}
+
+// getDatacapBalance returns the datacap held by addr at the tipset with key tsk
+func getDatacapBalance(ctx context.Context, node api.FullNode, addr address.Address, tsk filTypes.TipSetKey) (abi.TokenAmount, error) {
+	dataCap, err := tools.LotusCall(ctx, lotusCallTimeout(ctx), func(ctx context.Context) (*abi.StoragePower, error) {
+		return node.StateVerifiedClientStatus(ctx, addr, tsk)
+	})
+	if err != nil {
+		return abi.TokenAmount{}, err
+	}
+	if dataCap == nil {
+		return big.Zero(), nil
+	}
+
+	// Lotus gives the datacap in bytes, while the datacap token has 18 decimals
+	return big.Mul(*dataCap, builtin.TokenPrecision), nil
+}
+
+// requestedCurrencies returns the currencies of the balances to return for an
+// /account/balance request for currencies: FIL when none is given, and FIL and
+// DATACAP in the given order otherwise. Other currencies are rejected.
+func requestedCurrencies(currencies []*types.Currency) ([]*types.Currency, *types.Error) {
+	if len(currencies) == 0 {
+		return []*types.Currency{GetCurrencyData()}, nil
+	}
+
+	var requested []*types.Currency
+	for _, currency := range currencies {
+		switch {
+		case currency == nil:
+		case currency.Symbol == CurrencySymbol:
+			requested = append(requested, GetCurrencyData())
+		case currency.Symbol == DatacapSymbol:
+			requested = append(requested, GetDatacapCurrencyData())
+		default:
+			return nil, BuildError(ErrUnsupportedCurrency, fmt.Errorf("unknown currency %s", currency.Symbol), true)
+		}
+	}
+	return requested, nil
+}
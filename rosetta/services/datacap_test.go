@@ -0,0 +1,128 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/coinbase/rosetta-sdk-go/types"
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/builtin/v17/datacap"
+	filTypes "github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/node/modules/dtypes"
+	"github.com/stretchr/testify/mock"
+	cbg "github.com/whyrusleeping/cbor-gen"
+	mocks "github.com/zondax/rosetta-filecoin-proxy/rosetta/services/mocks"
+)
+
+func TestDecodeDatacapMovement(t *testing.T) {
+	mockCaller, _ := address.NewFromString("t01001")
+	mockOwner, _ := address.NewFromString("t01002")
+	mockTo, _ := address.NewFromString("t01003")
+	amount := abi.NewTokenAmount(1 << 40)
+
+	encode := func(params cbg.CBORMarshaler) []byte {
+		buf := new(bytes.Buffer)
+		_ = params.MarshalCBOR(buf)
+		return buf.Bytes()
+	}
+
+	tests := []struct {
+		method string
+		params []byte
+		want   *datacapMovement
+	}{
+		{
+			method: "MintExported",
+			params: encode(&datacap.MintParams{To: mockTo, Amount: amount}),
+			want:   &datacapMovement{OpDatacapMint, address.Undef, mockTo, amount},
+		},
+		{
+			method: "TransferExported",
+			params: encode(&datacap.TransferParams{To: mockTo, Amount: amount}),
+			want:   &datacapMovement{OpDatacapTransfer, mockCaller, mockTo, amount},
+		},
+		{
+			method: "TransferFromExported",
+			params: encode(&datacap.TransferFromParams{From: mockOwner, To: mockTo, Amount: amount}),
+			want:   &datacapMovement{OpDatacapTransfer, mockOwner, mockTo, amount},
+		},
+		{
+			method: "BurnExported",
+			params: encode(&datacap.BurnParams{Amount: amount}),
+			want:   &datacapMovement{OpDatacapBurn, mockCaller, address.Undef, amount},
+		},
+		{
+			method: "DestroyExported",
+			params: encode(&datacap.DestroyParams{Owner: mockOwner, Amount: amount}),
+			want:   &datacapMovement{OpDatacapBurn, mockOwner, address.Undef, amount},
+		},
+		{
+			method: "BalanceExported",
+			params: encode(&mockOwner),
+			want:   nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			got, err := decodeDatacapMovement(tt.method, mockCaller, tt.params)
+			if err != nil {
+				t.Fatalf("decodeDatacapMovement() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decodeDatacapMovement() got = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetDatacapBalance(t *testing.T) {
+	mockAddr, _ := address.NewFromString("t01001")
+	dataCap := abi.NewStoragePower(1024)
+
+	nodeMock := mocks.FullNode{}
+	nodeMock.On("StateVerifiedClientStatus", mock.Anything, mockAddr, mock.Anything).
+		Return(&dataCap, nil)
+
+	balance, err := getDatacapBalance(context.Background(), &nodeMock, mockAddr, filTypes.EmptyTSK)
+	if err != nil {
+		t.Fatalf("getDatacapBalance() error = %v", err)
+	}
+	if balance.String() != "1024000000000000000000" {
+		t.Errorf("getDatacapBalance() got = %s, want 1024000000000000000000", balance)
+	}
+
+	requested, currencyErr := requestedCurrencies([]*types.Currency{{Symbol: DatacapSymbol}, {Symbol: CurrencySymbol}})
+	want := []*types.Currency{GetDatacapCurrencyData(), GetCurrencyData()}
+	if currencyErr != nil || !reflect.DeepEqual(requested, want) {
+		t.Errorf("requestedCurrencies() got = %v, %v, want %v", requested, currencyErr, want)
+	}
+
+	// Token balances aren't available
+	_, currencyErr = requestedCurrencies([]*types.Currency{{Symbol: CurrencySymbol}, {Symbol: "USDFC"}})
+	if currencyErr == nil || currencyErr.Code != ErrUnsupportedCurrency.Code {
+		t.Errorf("requestedCurrencies() error = %v, want %v", currencyErr, ErrUnsupportedCurrency)
+	}
+}
+
+func TestDatacapBalanceOfSubAccount(t *testing.T) {
+	nodeMock := mocks.FullNode{}
+	nodeMock.On("StateNetworkName", mock.Anything).
+		Return(dtypes.NetworkName(NetworkID.Network), nil)
+
+	// Datacap isn't split into subaccounts
+	s := &AccountAPIService{network: NetworkID, node: &nodeMock}
+	_, err := s.AccountBalance(context.Background(), &types.AccountBalanceRequest{
+		NetworkIdentifier: NetworkID,
+		AccountIdentifier: &types.AccountIdentifier{
+			Address:    "f01000",
+			SubAccount: &types.SubAccountIdentifier{Address: LockedBalanceStr},
+		},
+		Currencies: []*types.Currency{{Symbol: CurrencySymbol}, {Symbol: DatacapSymbol}},
+	})
+	if err != ErrSubAccountCurrency {
+		t.Errorf("AccountBalance() error = %v, want %v", err, ErrSubAccountCurrency)
+	}
+}
@@ -1,11 +1,13 @@
 package services
 
 import (
+	"errors"
 	"runtime"
 	"strings"
 
 	"github.com/coinbase/rosetta-sdk-go/types"
 	logging "github.com/ipfs/go-log"
+	"github.com/zondax/rosetta-filecoin-proxy/rosetta/tools"
 )
 
 const LotusErrKey = "lotusErr"
@@ -249,7 +251,7 @@ var (
 
 	ErrAddNotMSig = &types.Error{
 		Code:      40,
-		Message:   "address does not correspond to a multisig account",
+		Message:   "address does not correspond to a multisig nor a storage miner account",
 		Retriable: false,
 	}
 
@@ -295,6 +297,78 @@ var (
 		Retriable: true,
 	}
 
+	ErrTransactionNotFound = &types.Error{
+		Code:      48,
+		Message:   "transaction not found in block",
+		Retriable: false,
+	}
+
+	ErrInvalidOperations = &types.Error{
+		Code:      49,
+		Message:   "invalid operations for transaction construction",
+		Retriable: false,
+	}
+
+	ErrUnableToDeriveAddress = &types.Error{
+		Code:      50,
+		Message:   "unable to derive address from public key",
+		Retriable: false,
+	}
+
+	ErrUnableToConstructTx = &types.Error{
+		Code:      51,
+		Message:   "unable to construct transaction",
+		Retriable: false,
+	}
+
+	ErrInvalidSignature = &types.Error{
+		Code:      52,
+		Message:   "invalid signature for transaction",
+		Retriable: false,
+	}
+
+	ErrOfflineMode = &types.Error{
+		Code:      53,
+		Message:   "endpoint not available in offline mode",
+		Retriable: false,
+	}
+
+	ErrBlockHashNotIndexed = &types.Error{
+		Code:      54,
+		Message:   "block hash not indexed yet, request the block by index",
+		Retriable: true,
+	}
+
+	ErrBlockNotConfirmed = &types.Error{
+		Code:      55,
+		Message:   "block is above the safe head, it's not confirmed yet",
+		Retriable: true,
+	}
+
+	ErrUnableToGetEvents = &types.Error{
+		Code:      56,
+		Message:   "unable to get the events emitted by messages",
+		Retriable: true,
+	}
+
+	ErrMustSpecifyMinerSubAccount = &types.Error{
+		Code:      57,
+		Message:   "a valid storage miner subaccount must be specified ('AvailableBalance', 'VestingFunds', 'InitialPledge', 'PreCommitDeposits' or 'FeeDebt')",
+		Retriable: false,
+	}
+
+	ErrUnsupportedCurrency = &types.Error{
+		Code:      58,
+		Message:   "unsupported currency, only 'FIL' and 'DATACAP' balances are available",
+		Retriable: false,
+	}
+
+	ErrSubAccountCurrency = &types.Error{
+		Code:      59,
+		Message:   "subaccounts only have 'FIL' balances",
+		Retriable: false,
+	}
+
 	ErrorList = []*types.Error{
 		ErrUnableToGetChainID,
 		ErrInvalidBlockchain,
@@ -343,10 +417,35 @@ var (
 		ErrUnableToEstimateGasFeeCap,
 		ErrOperationNotSupported,
 		ErrUnableToGetTrace,
+		ErrTransactionNotFound,
+		ErrInvalidOperations,
+		ErrUnableToDeriveAddress,
+		ErrUnableToConstructTx,
+		ErrInvalidSignature,
+		ErrOfflineMode,
+		ErrBlockHashNotIndexed,
+		ErrBlockNotConfirmed,
+		ErrUnableToGetEvents,
+		ErrMustSpecifyMinerSubAccount,
+		ErrUnsupportedCurrency,
+		ErrSubAccountCurrency,
 	}
 )
 
 func BuildError(proxyErr *types.Error, lotusErr error, showDetails bool) *types.Error {
+	return buildError(proxyErr, lotusErr, showDetails)
+}
+
+// BuildLotusError is like BuildError for errors returned by tools.LotusCall,
+// answering with ErrLotusCallTimedOut if the call timed out
+func BuildLotusError(proxyErr *types.Error, lotusErr error, showDetails bool) *types.Error {
+	if errors.Is(lotusErr, tools.ErrCallTimedOut) {
+		proxyErr = ErrLotusCallTimedOut
+	}
+	return buildError(proxyErr, lotusErr, showDetails)
+}
+
+func buildError(proxyErr *types.Error, lotusErr error, showDetails bool) *types.Error {
 	lotusMsg := ""
 	proxyMsg := "Proxy: " + proxyErr.Message
 	if lotusErr != nil {
@@ -361,7 +460,7 @@ func BuildError(proxyErr *types.Error, lotusErr error, showDetails bool) *types.
 	}
 
 	// log error with additional details
-	_, fn, line, ok := runtime.Caller(1)
+	_, fn, line, ok := runtime.Caller(2)
 	if ok {
 		file := strings.Split(fn, "/")
 		Logger.Info("Error on file: ", file[len(file)-1], ":", line)
@@ -0,0 +1,35 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/coinbase/rosetta-sdk-go/types"
+	"github.com/zondax/rosetta-filecoin-proxy/rosetta/tools"
+)
+
+func TestBuildLotusError(t *testing.T) {
+	tests := []struct {
+		name     string
+		lotusErr error
+		want     *types.Error
+	}{
+		{
+			name:     "TimedOut",
+			lotusErr: tools.ErrCallTimedOut,
+			want:     ErrLotusCallTimedOut,
+		},
+		{
+			name:     "Failed",
+			lotusErr: errors.New("actor not found"),
+			want:     ErrUnableToGetBlk,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := BuildLotusError(ErrUnableToGetBlk, tt.lotusErr, true); got != tt.want {
+				t.Errorf("BuildLotusError() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/filecoin-project/go-f3/certs"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/lotus/api"
+	filTypes "github.com/filecoin-project/lotus/chain/types"
+	"github.com/zondax/rosetta-filecoin-proxy/rosetta/tools"
+)
+
+const (
+	// Epochs after which tipsets can't be reverted under Expected Consensus
+	ECFinality abi.ChainEpoch = 900
+
+	// Finality sources
+	FinalitySourceF3 = "F3"
+	FinalitySourceEC = "EC"
+
+	// Block and network status metadata
+	FinalizedKey      = "finalized"
+	FinalitySourceKey = "finalitySource"
+	FinalizedBlockKey = "finalizedBlockIdentifier"
+)
+
+var errNoFinalityCertificate = errors.New("no finality certificate yet")
+
+// Finality is the latest finalized tipset, and how it was finalized
+type Finality struct {
+	Height    abi.ChainEpoch
+	TipSetKey filTypes.TipSetKey
+	// One of FinalitySourceF3 or FinalitySourceEC
+	Source string
+}
+
+// getFinality returns the head of the latest chain finalized by F3. When F3 isn't
+// running, it falls back to the tipset ECFinality epochs below the chain's head.
+func getFinality(ctx context.Context, node api.FullNode) (*Finality, error) {
+	running, err := tools.LotusCall(ctx, lotusCallTimeout(ctx), func(ctx context.Context) (bool, error) {
+		return node.F3IsRunning(ctx)
+	})
+	if err == nil && running {
+		finality, err := getF3Finality(ctx, node)
+		if err == nil {
+			return finality, nil
+		}
+		Logger.Debugf("could not get F3 finality, falling back to EC: %s", err.Error())
+	}
+
+	head, err := tools.LotusCall(ctx, lotusCallTimeout(ctx), func(ctx context.Context) (*filTypes.TipSet, error) {
+		return node.ChainHead(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	height := head.Height() - ECFinality
+	if height < 0 {
+		height = 0
+	}
+	tipSet, err := tools.LotusCall(ctx, lotusCallTimeout(ctx), func(ctx context.Context) (*filTypes.TipSet, error) {
+		return node.ChainGetTipSetByHeight(ctx, height, head.Key())
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Finality{Height: tipSet.Height(), TipSetKey: tipSet.Key(), Source: FinalitySourceEC}, nil
+}
+
+func getF3Finality(ctx context.Context, node api.FullNode) (*Finality, error) {
+	cert, err := tools.LotusCall(ctx, lotusCallTimeout(ctx), func(ctx context.Context) (*certs.FinalityCertificate, error) {
+		return node.F3GetLatestCertificate(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if cert == nil || cert.ECChain.IsZero() {
+		return nil, errNoFinalityCertificate
+	}
+
+	head := cert.ECChain.Head()
+	key, err := filTypes.TipSetKeyFromBytes(head.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Finality{Height: abi.ChainEpoch(head.Epoch), TipSetKey: key, Source: FinalitySourceF3}, nil
+}
+
+// finalityTracker tells whether tipsets are finalized, remembering the latest finality
+// seen, as the tipsets below it are final for good
+type finalityTracker struct {
+	node api.FullNode
+
+	mu     sync.Mutex
+	latest *Finality
+}
+
+func newFinalityTracker(node api.FullNode) *finalityTracker {
+	return &finalityTracker{node: node}
+}
+
+// isFinalized reports whether the tipset at height is finalized, and by which source.
+// Lotus is only called for tipsets above the latest finality seen.
+func (f *finalityTracker) isFinalized(ctx context.Context, height abi.ChainEpoch) (bool, string, error) {
+	f.mu.Lock()
+	latest := f.latest
+	f.mu.Unlock()
+
+	if latest == nil || height > latest.Height {
+		finality, err := getFinality(ctx, f.node)
+		if err != nil {
+			return false, "", err
+		}
+
+		f.mu.Lock()
+		if f.latest == nil || finality.Height >= f.latest.Height {
+			f.latest = finality
+		}
+		latest = f.latest
+		f.mu.Unlock()
+	}
+
+	return height <= latest.Height, latest.Source, nil
+}
@@ -0,0 +1,69 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/filecoin-project/go-f3/certs"
+	"github.com/filecoin-project/go-f3/gpbft"
+	"github.com/filecoin-project/go-state-types/abi"
+	filTypes "github.com/filecoin-project/lotus/chain/types"
+	"github.com/stretchr/testify/mock"
+	mocks "github.com/zondax/rosetta-filecoin-proxy/rosetta/services/mocks"
+)
+
+func TestGetFinality(t *testing.T) {
+	chain := buildMockChain(1000)
+	mockPowerTable, _ := chain[0].Cids()[0].Prefix().Sum([]byte("power"))
+	mockECChain, _ := gpbft.NewChain(
+		&gpbft.TipSet{Epoch: 990, Key: chain[990].Key().Bytes(), PowerTable: mockPowerTable},
+		&gpbft.TipSet{Epoch: 995, Key: chain[995].Key().Bytes(), PowerTable: mockPowerTable},
+	)
+
+	// F3 running
+	nodeMock := mocks.FullNode{}
+	nodeMock.On("F3IsRunning", mock.Anything).Return(true, nil)
+	nodeMock.On("F3GetLatestCertificate", mock.Anything).
+		Return(&certs.FinalityCertificate{ECChain: mockECChain}, nil)
+
+	finality, err := getFinality(context.Background(), &nodeMock)
+	if err != nil {
+		t.Fatalf("getFinality() error = %v", err)
+	}
+	want := Finality{Height: 995, TipSetKey: chain[995].Key(), Source: FinalitySourceF3}
+	if *finality != want {
+		t.Errorf("getFinality() got = %+v, want %+v", *finality, want)
+	}
+
+	// F3 disabled, EC finality is used
+	nodeMock = mocks.FullNode{}
+	nodeMock.On("F3IsRunning", mock.Anything).Return(false, errors.New("f3 is disabled"))
+	nodeMock.On("ChainHead", mock.Anything).Return(chain[1000], nil)
+	nodeMock.On("ChainGetTipSetByHeight", mock.Anything, mock.Anything, mock.Anything).
+		Return(func(ctx context.Context, height abi.ChainEpoch, tsk filTypes.TipSetKey) *filTypes.TipSet {
+			return chain[height]
+		}, nil)
+
+	finality, err = getFinality(context.Background(), &nodeMock)
+	if err != nil {
+		t.Fatalf("getFinality() error = %v", err)
+	}
+	want = Finality{Height: 100, TipSetKey: chain[100].Key(), Source: FinalitySourceEC}
+	if *finality != want {
+		t.Errorf("getFinality() got = %+v, want %+v", *finality, want)
+	}
+
+	// Tipsets below the latest finality seen don't call Lotus again
+	tracker := newFinalityTracker(&nodeMock)
+	for _, tt := range []struct {
+		height    abi.ChainEpoch
+		finalized bool
+	}{{100, true}, {50, true}, {101, false}} {
+		finalized, source, err := tracker.isFinalized(context.Background(), tt.height)
+		if err != nil || finalized != tt.finalized || source != FinalitySourceEC {
+			t.Errorf("isFinalized(%d) got = %v, %s, %v, want %v", tt.height, finalized, source, err, tt.finalized)
+		}
+	}
+	nodeMock.AssertNumberOfCalls(t, "ChainHead", 3)
+}
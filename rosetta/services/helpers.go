@@ -17,6 +17,7 @@ import (
 	"github.com/coinbase/rosetta-sdk-go/types"
 	"github.com/filecoin-project/lotus/api"
 	filTypes "github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/node/modules/dtypes"
 	"github.com/ipfs/go-cid"
 	"github.com/multiformats/go-multihash"
 )
@@ -57,9 +58,11 @@ func ValidateNetworkId(ctx context.Context, node *api.FullNode, networkId *types
 	}
 
 	fullAPI := *node
-	validNetwork, err := fullAPI.StateNetworkName(ctx)
+	validNetwork, err := tools.LotusCall(ctx, lotusCallTimeout(ctx), func(ctx context.Context) (dtypes.NetworkName, error) {
+		return fullAPI.StateNetworkName(ctx)
+	})
 	if err != nil {
-		return BuildError(ErrUnableToRetrieveNetworkName, err, true)
+		return BuildLotusError(ErrUnableToRetrieveNetworkName, err, true)
 	}
 
 	if networkId.Network != string(validNetwork) {
@@ -69,6 +72,25 @@ func ValidateNetworkId(ctx context.Context, node *api.FullNode, networkId *types
 	return nil
 }
 
+// ValidateNetworkIdOffline checks the requested network against the one the
+// proxy is serving, without querying the node
+func ValidateNetworkIdOffline(network *types.NetworkIdentifier, networkId *types.NetworkIdentifier) *types.Error {
+
+	if networkId == nil || network == nil {
+		return ErrMalformedValue
+	}
+
+	if networkId.Blockchain != network.Blockchain {
+		return BuildError(ErrInvalidBlockchain, nil, true)
+	}
+
+	if networkId.Network != network.Network {
+		return BuildError(ErrInvalidNetwork, nil, true)
+	}
+
+	return nil
+}
+
 func GetCurrencyData() *types.Currency {
 	return &types.Currency{
 		Symbol:   CurrencySymbol,
@@ -77,11 +99,13 @@ func GetCurrencyData() *types.Currency {
 	}
 }
 
-func GetActorNameFromAddress(address address.Address, lib *rosettaFilecoinLib.RosettaConstructionFilecoin) string {
+// GetActorNameFromAddress returns the name of the actor behind address as it
+// was at tipSet, or at chain's head if tipSet is nil
+func GetActorNameFromAddress(ctx context.Context, address address.Address, lib *rosettaFilecoinLib.RosettaConstructionFilecoin, tipSet *filTypes.TipSet) string {
 	var actorCode cid.Cid
 	// Search for actor in cache
 	var err error
-	actorCode, err = tools.ActorsDB.GetActorCode(address)
+	actorCode, err = tools.ActorsDB.GetActorCode(ctx, address, tipSet)
 	if err != nil {
 		return actors.UnknownStr
 	}
@@ -146,7 +170,9 @@ func FindMethodNameInAllActors(methodNum uint64) string {
 	return actors.UnknownStr
 }
 
-func GetMethodName(msg *filTypes.MessageTrace, lib *rosettaFilecoinLib.RosettaConstructionFilecoin) (string, *types.Error) {
+// GetMethodName returns the name of the method called by msg, decoded with the
+// receiver actor that existed at tipSet
+func GetMethodName(ctx context.Context, msg *filTypes.MessageTrace, lib *rosettaFilecoinLib.RosettaConstructionFilecoin, tipSet *filTypes.TipSet) (string, *types.Error) {
 	if msg == nil {
 		return "", BuildError(ErrMalformedValue, nil, true)
 	}
@@ -161,7 +187,7 @@ func GetMethodName(msg *filTypes.MessageTrace, lib *rosettaFilecoinLib.RosettaCo
 		return "Constructor", nil
 	}
 
-	actorName := GetActorNameFromAddress(msg.To, lib)
+	actorName := GetActorNameFromAddress(ctx, msg.To, lib, tipSet)
 	method := GetMethodByActorName(actorName)
 
 	// If method is unknown check for fallback behavior
@@ -234,9 +260,9 @@ func GetMethodByActorName(actorName string) interface{} {
 	return method
 }
 
-func GetActorPubKey(add address.Address, lib *rosettaFilecoinLib.RosettaConstructionFilecoin) (string, *types.Error) {
+func GetActorPubKey(ctx context.Context, add address.Address, lib *rosettaFilecoinLib.RosettaConstructionFilecoin, tipSet *filTypes.TipSet) (string, *types.Error) {
 
-	actorCode, err := tools.ActorsDB.GetActorCode(add)
+	actorCode, err := tools.ActorsDB.GetActorCode(ctx, add, tipSet)
 	if err != nil {
 		Logger.Error("could not get actor code from address. Err:", err.Error())
 		return add.String(), nil
@@ -247,16 +273,16 @@ func GetActorPubKey(add address.Address, lib *rosettaFilecoinLib.RosettaConstruc
 
 	// Handler for msig
 	if lib.BuiltinActors.IsActor(actorCode, actors.ActorMultisigName) {
-		return getPubKeyForMsig(add)
+		return getPubKeyForMsig(ctx, add)
 	}
 
 	// Handler for storage miner
 	if lib.BuiltinActors.IsActor(actorCode, actors.ActorStorageMinerName) {
-		return getPubKeyForStorageMiner(add)
+		return getPubKeyForStorageMiner(ctx, add)
 	}
 
 	// For other types, try to return address in "robust" format
-	pubKey, err := tools.ActorsDB.GetActorPubKey(add, false)
+	pubKey, err := tools.ActorsDB.GetActorPubKey(ctx, add, false)
 	if err != nil {
 		pubKey = add.String()
 	}
@@ -264,7 +290,7 @@ func GetActorPubKey(add address.Address, lib *rosettaFilecoinLib.RosettaConstruc
 	return pubKey, nil
 }
 
-func getPubKeyForMsig(add address.Address) (string, *types.Error) {
+func getPubKeyForMsig(ctx context.Context, add address.Address) (string, *types.Error) {
 
 	var (
 		pubKey string
@@ -275,7 +301,7 @@ func getPubKeyForMsig(add address.Address) (string, *types.Error) {
 	case address.BLS, address.SECP256K1, address.Actor:
 		// Use "short" address for msig actors since can be mixed on the blockchain
 		// and we need them to be normalized to any of the two formats
-		pubKey, err = tools.ActorsDB.GetActorPubKey(add, true)
+		pubKey, err = tools.ActorsDB.GetActorPubKey(ctx, add, true)
 		if err != nil {
 			pubKey = add.String()
 		}
@@ -289,7 +315,7 @@ func getPubKeyForMsig(add address.Address) (string, *types.Error) {
 	return pubKey, nil
 }
 
-func getPubKeyForStorageMiner(add address.Address) (string, *types.Error) {
+func getPubKeyForStorageMiner(ctx context.Context, add address.Address) (string, *types.Error) {
 
 	var (
 		pubKey string
@@ -300,7 +326,7 @@ func getPubKeyForStorageMiner(add address.Address) (string, *types.Error) {
 	case address.BLS, address.SECP256K1, address.Actor:
 		// Use "short" address for storage miners actors since can be mixed on the blockchain
 		// and we need them to be normalized to any of the two formats
-		pubKey, err = tools.ActorsDB.GetActorPubKey(add, true)
+		pubKey, err = tools.ActorsDB.GetActorPubKey(ctx, add, true)
 		if err != nil {
 			pubKey = add.String()
 		}
@@ -5,6 +5,7 @@ import (
 	filTypes "github.com/filecoin-project/lotus/chain/types"
 	"github.com/ipfs/go-cid"
 	filLib "github.com/zondax/rosetta-filecoin-lib"
+	"github.com/zondax/rosetta-filecoin-proxy/rosetta/tools"
 
 	"github.com/coinbase/rosetta-sdk-go/server"
 	"github.com/coinbase/rosetta-sdk-go/types"
@@ -32,6 +33,7 @@ func (m *MemPoolAPIService) Mempool(
 	ctx context.Context,
 	request *types.NetworkRequest,
 ) (*types.MempoolResponse, *types.Error) {
+	ctx = withEndpoint(ctx, MempoolEndpoint)
 
 	errNet := ValidateNetworkId(ctx, &m.node, request.NetworkIdentifier)
 	if errNet != nil {
@@ -48,15 +50,9 @@ func (m *MemPoolAPIService) Mempool(
 		return nil, BuildError(ErrUnableToGetUnsyncedBlock, nil, true)
 	}
 
-	// Get head TipSet
-	headTipSet, err := m.node.ChainHead(ctx)
-	if err != nil || headTipSet == nil {
-		return nil, BuildError(ErrUnableToGetLatestBlk, err, true)
-	}
-
-	pendingMsg, err := m.node.MpoolPending(ctx, headTipSet.Key())
-	if err != nil {
-		return nil, BuildError(ErrUnableToGetTxns, err, true)
+	_, pendingMsg, pendingErr := m.getPendingMessages(ctx)
+	if pendingErr != nil {
+		return nil, pendingErr
 	}
 
 	var transactions []*types.TransactionIdentifier
@@ -78,6 +74,7 @@ func (m MemPoolAPIService) MempoolTransaction(
 	ctx context.Context,
 	request *types.MempoolTransactionRequest,
 ) (*types.MempoolTransactionResponse, *types.Error) {
+	ctx = withEndpoint(ctx, MempoolTransactionEndpoint)
 
 	errNet := ValidateNetworkId(ctx, &m.node, request.NetworkIdentifier)
 	if errNet != nil {
@@ -103,15 +100,9 @@ func (m MemPoolAPIService) MempoolTransaction(
 		return nil, BuildError(ErrMalformedValue, err, true)
 	}
 
-	// Get head TipSet
-	headTipSet, err := m.node.ChainHead(ctx)
-	if err != nil || headTipSet == nil {
-		return nil, BuildError(ErrUnableToGetLatestBlk, err, true)
-	}
-
-	pendingMsg, err := m.node.MpoolPending(ctx, headTipSet.Key())
-	if err != nil {
-		return nil, BuildError(ErrUnableToGetTxns, err, true)
+	headTipSet, pendingMsg, pendingErr := m.getPendingMessages(ctx)
+	if pendingErr != nil {
+		return nil, pendingErr
 	}
 
 	var found = false
@@ -128,13 +119,13 @@ func (m MemPoolAPIService) MempoolTransaction(
 			Operations: []*types.Operation{},
 		}
 
-		opType, err := GetMethodName(&filTypes.MessageTrace{
+		opType, err := GetMethodName(ctx, &filTypes.MessageTrace{
 			From:   msg.Message.From,
 			To:     msg.Message.To,
 			Value:  msg.Message.Value,
 			Method: msg.Message.Method,
 			Params: msg.Message.Params,
-		}, m.rosettaLib)
+		}, m.rosettaLib, headTipSet)
 		if err != nil {
 			return nil, err
 		}
@@ -159,3 +150,23 @@ func (m MemPoolAPIService) MempoolTransaction(
 
 	return resp, nil
 }
+
+// getPendingMessages returns chain's head TipSet and the messages pending on top of it
+func (m MemPoolAPIService) getPendingMessages(ctx context.Context) (*filTypes.TipSet, []*filTypes.SignedMessage, *types.Error) {
+	// Get head TipSet
+	headTipSet, err := tools.LotusCall(ctx, lotusCallTimeout(ctx), func(ctx context.Context) (*filTypes.TipSet, error) {
+		return m.node.ChainHead(ctx)
+	})
+	if err != nil || headTipSet == nil {
+		return nil, nil, BuildLotusError(ErrUnableToGetLatestBlk, err, true)
+	}
+
+	pendingMsg, err := tools.LotusCall(ctx, lotusCallTimeout(ctx), func(ctx context.Context) ([]*filTypes.SignedMessage, error) {
+		return m.node.MpoolPending(ctx, headTipSet.Key())
+	})
+	if err != nil {
+		return nil, nil, BuildLotusError(ErrUnableToGetTxns, err, true)
+	}
+
+	return headTipSet, pendingMsg, nil
+}
@@ -0,0 +1,41 @@
+package services
+
+import (
+	"net/http"
+
+	"github.com/coinbase/rosetta-sdk-go/server"
+	"github.com/zondax/rosetta-filecoin-proxy/rosetta/tools"
+)
+
+// MetricsAPIController exposes the proxy's internal metrics.
+// It implements the server.Router interface.
+type MetricsAPIController struct{}
+
+// NewMetricsAPIController creates a new instance of a MetricsAPIController.
+func NewMetricsAPIController() server.Router {
+	return &MetricsAPIController{}
+}
+
+// Routes returns all of the api route for the MetricsAPIController
+func (c *MetricsAPIController) Routes() server.Routes {
+	return server.Routes{
+		{
+			Name:        "ActorsDBMetrics",
+			Method:      http.MethodGet,
+			Pattern:     "/metrics/actors-db",
+			HandlerFunc: c.ActorsDBMetrics,
+		},
+	}
+}
+
+// ActorsDBMetrics returns the usage counters of the actors database, if
+// the configured backend keeps them
+func (c *MetricsAPIController) ActorsDBMetrics(w http.ResponseWriter, r *http.Request) {
+	provider, ok := tools.ActorsDB.(tools.MetricsProvider)
+	if !ok {
+		server.EncodeJSONResponse(ErrOperationNotSupported, http.StatusNotFound, w)
+		return
+	}
+
+	server.EncodeJSONResponse(provider.Metrics(), http.StatusOK, w)
+}
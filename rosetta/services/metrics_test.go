@@ -0,0 +1,43 @@
+package services
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/filecoin-project/lotus/api"
+	mocks "github.com/zondax/rosetta-filecoin-proxy/rosetta/services/mocks"
+	"github.com/zondax/rosetta-filecoin-proxy/rosetta/tools"
+)
+
+func TestMetricsAPIController_ActorsDBMetrics(t *testing.T) {
+	var node api.FullNode = &mocks.FullNode{}
+	c := &MetricsAPIController{}
+
+	tools.ActorsDB = &tools.Cache{}
+	tools.ActorsDB.NewImpl(&node)
+
+	recorder := httptest.NewRecorder()
+	c.ActorsDBMetrics(recorder, httptest.NewRequest(http.MethodGet, "/metrics/actors-db", nil))
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("ActorsDBMetrics() got status = %d, want %d", recorder.Code, http.StatusNotFound)
+	}
+
+	tools.ActorsDB = &tools.BoundedCache{Capacity: 10}
+	tools.ActorsDB.NewImpl(&node)
+
+	recorder = httptest.NewRecorder()
+	c.ActorsDBMetrics(recorder, httptest.NewRequest(http.MethodGet, "/metrics/actors-db", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("ActorsDBMetrics() got status = %d, want %d", recorder.Code, http.StatusOK)
+	}
+
+	var metrics tools.CacheMetrics
+	if err := json.Unmarshal(recorder.Body.Bytes(), &metrics); err != nil {
+		t.Fatal(err)
+	}
+	if metrics.Capacity != 10 {
+		t.Errorf("ActorsDBMetrics() got capacity = %d, want %d", metrics.Capacity, 10)
+	}
+}
@@ -0,0 +1,66 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/blockstore"
+	"github.com/filecoin-project/lotus/chain/actors/adt"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/miner"
+	filTypes "github.com/filecoin-project/lotus/chain/types"
+	cbor "github.com/ipfs/go-ipld-cbor"
+	"github.com/zondax/rosetta-filecoin-proxy/rosetta/tools"
+)
+
+// isMinerSubAccount tells whether subAccount is one of the subaccounts of storage miners
+func isMinerSubAccount(subAccount string) bool {
+	switch subAccount {
+	case AvailableBalanceStr, VestingFundsStr, InitialPledgeStr, PreCommitDepositsStr, FeeDebtStr:
+		return true
+	default:
+		return false
+	}
+}
+
+// getMinerSubAccountBalance returns the balance of subAccount of the storage miner actor,
+// read from its state as given by StateGetActor
+func getMinerSubAccountBalance(ctx context.Context, node api.FullNode, actor *filTypes.Actor, subAccount string) (abi.TokenAmount, error) {
+	return tools.LotusCall(ctx, lotusCallTimeout(ctx), func(ctx context.Context) (abi.TokenAmount, error) {
+		store := adt.WrapStore(ctx, cbor.NewCborStore(blockstore.NewAPIBlockstore(node)))
+		mas, err := miner.Load(store, actor)
+		if err != nil {
+			return abi.TokenAmount{}, err
+		}
+		return minerSubAccountBalance(mas, actor.Balance, subAccount)
+	})
+}
+
+// minerSubAccountBalance returns the balance of subAccount of a storage miner with state mas
+// and the given actor balance
+func minerSubAccountBalance(mas miner.State, balance abi.TokenAmount, subAccount string) (abi.TokenAmount, error) {
+	switch subAccount {
+	case AvailableBalanceStr:
+		// Balance not locked nor owed as fee debt
+		return mas.AvailableBalance(balance)
+	case FeeDebtStr:
+		return mas.FeeDebt()
+	}
+
+	lockedFunds, err := mas.LockedFunds()
+	if err != nil {
+		return abi.TokenAmount{}, err
+	}
+	switch subAccount {
+	case VestingFundsStr:
+		// Block rewards still vesting
+		return lockedFunds.VestingFunds, nil
+	case InitialPledgeStr:
+		return lockedFunds.InitialPledgeRequirement, nil
+	case PreCommitDepositsStr:
+		return lockedFunds.PreCommitDeposits, nil
+	default:
+		return abi.TokenAmount{}, fmt.Errorf("unknown storage miner subaccount %s", subAccount)
+	}
+}
@@ -0,0 +1,79 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	actorstypes "github.com/filecoin-project/go-state-types/actors"
+	minerV17 "github.com/filecoin-project/go-state-types/builtin/v17/miner"
+	"github.com/filecoin-project/go-state-types/manifest"
+	"github.com/filecoin-project/lotus/chain/actors"
+	filTypes "github.com/filecoin-project/lotus/chain/types"
+	"github.com/stretchr/testify/mock"
+	mocks "github.com/zondax/rosetta-filecoin-proxy/rosetta/services/mocks"
+)
+
+func TestGetMinerSubAccountBalance(t *testing.T) {
+	minerCode, ok := actors.GetActorCodeID(actorstypes.Version17, manifest.MinerKey)
+	if !ok {
+		t.Fatal("could not get the code of v17 storage miners")
+	}
+
+	// Only the funds on the root of the state are read, other fields just need to be defined
+	mockCid, _ := abi.CidBuilder.Sum([]byte("mock"))
+	state := &minerV17.State{
+		Info:                       mockCid,
+		PreCommitDeposits:          abi.NewTokenAmount(100),
+		LockedFunds:                abi.NewTokenAmount(200),
+		FeeDebt:                    abi.NewTokenAmount(50),
+		InitialPledge:              abi.NewTokenAmount(300),
+		PreCommittedSectors:        mockCid,
+		PreCommittedSectorsCleanUp: mockCid,
+		AllocatedSectors:           mockCid,
+		Sectors:                    mockCid,
+		Deadlines:                  mockCid,
+	}
+	buf := new(bytes.Buffer)
+	if err := state.MarshalCBOR(buf); err != nil {
+		t.Fatal(err)
+	}
+	head, _ := abi.CidBuilder.Sum(buf.Bytes())
+
+	nodeMock := mocks.FullNode{}
+	nodeMock.On("ChainReadObj", mock.Anything, head).
+		Return(buf.Bytes(), nil)
+
+	actor := &filTypes.Actor{
+		Code:    minerCode,
+		Head:    head,
+		Balance: abi.NewTokenAmount(1000),
+	}
+
+	tests := []struct {
+		subAccount string
+		want       string
+	}{
+		{AvailableBalanceStr, "350"},
+		{VestingFundsStr, "200"},
+		{InitialPledgeStr, "300"},
+		{PreCommitDepositsStr, "100"},
+		{FeeDebtStr, "50"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.subAccount, func(t *testing.T) {
+			got, err := getMinerSubAccountBalance(context.Background(), &nodeMock, actor, tt.subAccount)
+			if err != nil {
+				t.Fatalf("getMinerSubAccountBalance() error = %v", err)
+			}
+			if got.String() != tt.want {
+				t.Errorf("getMinerSubAccountBalance() got = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	if isMinerSubAccount(LockedBalanceStr) {
+		t.Errorf("isMinerSubAccount() = true for a multisig subaccount")
+	}
+}
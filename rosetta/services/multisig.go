@@ -0,0 +1,109 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+
+	"github.com/filecoin-project/go-state-types/builtin"
+	"github.com/filecoin-project/go-state-types/builtin/v17/multisig"
+	filTypes "github.com/filecoin-project/lotus/chain/types"
+)
+
+// Names of the keys in the Metadata map of the operations of multisig transactions
+const (
+	// MultisigTxnIDKey specifies the ID of the transaction proposed, approved or cancelled.
+	MultisigTxnIDKey = "txnId"
+	// MultisigToKey specifies the destination of the proposed transaction.
+	MultisigToKey = "to"
+	// MultisigValueKey specifies the value of the proposed transaction, in attoFIL.
+	MultisigValueKey = "value"
+	// MultisigMethodKey specifies the method number of the proposed transaction.
+	MultisigMethodKey = "method"
+	// MultisigParamsKey specifies the decoded params of a proposed call to another method than Send.
+	MultisigParamsKey = "params"
+	// MultisigAppliedKey specifies whether the transaction was executed by this proposal or approval.
+	MultisigAppliedKey = "applied"
+)
+
+// multisigTxMetadata returns the metadata of the operations of a multisig Propose, Approve or
+// Cancel call, and whether it executed the transaction
+func (s *BlockAPIService) multisigTxMetadata(ctx context.Context, method string, trace *filTypes.ExecutionTrace, tipSet *filTypes.TipSet) (map[string]interface{}, bool) {
+	parsedParams, err := s.parseMsigParams(ctx, &trace.Msg, tipSet)
+	if err != nil {
+		parsedParams = ""
+	}
+
+	var ret []byte
+	if trace.MsgRct.ExitCode.IsSuccess() {
+		ret = trace.MsgRct.Return
+	}
+
+	md, applied, err := decodeMultisigTx(method, parsedParams, trace.Msg.Params, ret)
+	if err != nil {
+		Logger.Error("Could not parse message params for", method, err.Error())
+	}
+	return md, applied
+}
+
+// decodeMultisigTx decodes a multisig Propose, Approve or Cancel call, given its params as parsed
+// by ParseParamsMultisigTx, its raw params and its return, nil if the call failed
+func decodeMultisigTx(method string, parsedParams string, params []byte, ret []byte) (map[string]interface{}, bool, error) {
+	md := make(map[string]interface{})
+	applied := false
+
+	switch method {
+	case "Propose":
+		var proposal multisig.ProposeParams
+		if err := proposal.UnmarshalCBOR(bytes.NewReader(params)); err != nil {
+			return nil, false, err
+		}
+		md[MultisigToKey] = proposal.To.String()
+		md[MultisigValueKey] = proposal.Value.String()
+		md[MultisigMethodKey] = uint64(proposal.Method)
+
+		// Proposed sends are parsed whole, other proposals into the params of the proposed method
+		if proposal.Method != builtin.MethodSend && parsedParams != "" {
+			var innerParams map[string]interface{}
+			if json.Unmarshal([]byte(parsedParams), &innerParams) == nil {
+				md[MultisigParamsKey] = innerParams
+			}
+		}
+
+		if len(ret) > 0 {
+			var proposeRet multisig.ProposeReturn
+			if err := proposeRet.UnmarshalCBOR(bytes.NewReader(ret)); err != nil {
+				return md, false, err
+			}
+			md[MultisigTxnIDKey] = int64(proposeRet.TxnID)
+			md[MultisigAppliedKey] = proposeRet.Applied
+			applied = proposeRet.Applied
+		}
+	case "Approve", "Cancel":
+		var txnParams multisig.TxnIDParams
+		if parsedParams == "" || json.Unmarshal([]byte(parsedParams), &txnParams) != nil {
+			txnParams = multisig.TxnIDParams{}
+			if err := txnParams.UnmarshalCBOR(bytes.NewReader(params)); err != nil {
+				return nil, false, err
+			}
+		}
+		md[MultisigTxnIDKey] = int64(txnParams.ID)
+
+		if method == "Approve" && len(ret) > 0 {
+			var approveRet multisig.ApproveReturn
+			if err := approveRet.UnmarshalCBOR(bytes.NewReader(ret)); err != nil {
+				return md, false, err
+			}
+			md[MultisigAppliedKey] = approveRet.Applied
+			applied = approveRet.Applied
+		}
+	}
+
+	return md, applied, nil
+}
+
+// isExecutedSend tells whether subTrace, a call made by a multisig Propose or Approve call
+// that applied its transaction, is the Send executing it
+func isExecutedSend(trace *filTypes.ExecutionTrace, subTrace *filTypes.ExecutionTrace) bool {
+	return subTrace.Msg.From == trace.Msg.To && subTrace.Msg.Method == builtin.MethodSend
+}
@@ -0,0 +1,182 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/builtin"
+	"github.com/filecoin-project/go-state-types/builtin/v17/datacap"
+	"github.com/filecoin-project/go-state-types/builtin/v17/multisig"
+	filTypes "github.com/filecoin-project/lotus/chain/types"
+	cbg "github.com/whyrusleeping/cbor-gen"
+)
+
+func TestDecodeMultisigTx(t *testing.T) {
+	mockTo, _ := address.NewFromString("t01003")
+	mockSigner, _ := address.NewFromString("t01004")
+
+	encode := func(v cbg.CBORMarshaler) []byte {
+		buf := new(bytes.Buffer)
+		_ = v.MarshalCBOR(buf)
+		return buf.Bytes()
+	}
+	marshal := func(v interface{}) string {
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+
+	sendProposal := &multisig.ProposeParams{
+		To:     mockTo,
+		Value:  abi.NewTokenAmount(100),
+		Method: builtin.MethodSend,
+		Params: []byte{},
+	}
+	addSigner := &multisig.AddSignerParams{Signer: mockSigner, Increase: true}
+	addSignerProposal := &multisig.ProposeParams{
+		To:     mockTo,
+		Value:  abi.NewTokenAmount(0),
+		Method: builtin.MethodsMultisig.AddSigner,
+		Params: encode(addSigner),
+	}
+	// Params of the proposed method having a To field
+	datacapTransfer := &datacap.TransferParams{To: mockSigner, Amount: abi.NewTokenAmount(5), OperatorData: []byte{}}
+	datacapTransferProposal := &multisig.ProposeParams{
+		To:     builtin.DatacapActorAddr,
+		Value:  abi.NewTokenAmount(0),
+		Method: builtin.MethodsDatacap.TransferExported,
+		Params: encode(datacapTransfer),
+	}
+	var datacapTransferParsed map[string]interface{}
+	_ = json.Unmarshal([]byte(marshal(datacapTransfer)), &datacapTransferParsed)
+	txnID := &multisig.TxnIDParams{ID: 7}
+
+	tests := []struct {
+		name         string
+		method       string
+		parsedParams string
+		params       []byte
+		ret          []byte
+		want         map[string]interface{}
+		wantApplied  bool
+	}{
+		{
+			name:         "ProposeSend",
+			method:       "Propose",
+			parsedParams: marshal(sendProposal),
+			params:       encode(sendProposal),
+			ret:          encode(&multisig.ProposeReturn{TxnID: 7, Applied: false}),
+			want: map[string]interface{}{
+				MultisigToKey:      mockTo.String(),
+				MultisigValueKey:   "100",
+				MultisigMethodKey:  uint64(builtin.MethodSend),
+				MultisigTxnIDKey:   int64(7),
+				MultisigAppliedKey: false,
+			},
+		},
+		{
+			name:         "ProposeAddSigner",
+			method:       "Propose",
+			parsedParams: marshal(addSigner),
+			params:       encode(addSignerProposal),
+			ret:          encode(&multisig.ProposeReturn{TxnID: 8, Applied: true}),
+			want: map[string]interface{}{
+				MultisigToKey:     mockTo.String(),
+				MultisigValueKey:  "0",
+				MultisigMethodKey: uint64(builtin.MethodsMultisig.AddSigner),
+				MultisigParamsKey: map[string]interface{}{
+					"Signer":   mockSigner.String(),
+					"Increase": true,
+				},
+				MultisigTxnIDKey:   int64(8),
+				MultisigAppliedKey: true,
+			},
+			wantApplied: true,
+		},
+		{
+			name:         "ProposeDatacapTransfer",
+			method:       "Propose",
+			parsedParams: marshal(datacapTransfer),
+			params:       encode(datacapTransferProposal),
+			ret:          encode(&multisig.ProposeReturn{TxnID: 9, Applied: false}),
+			want: map[string]interface{}{
+				MultisigToKey:      builtin.DatacapActorAddr.String(),
+				MultisigValueKey:   "0",
+				MultisigMethodKey:  uint64(builtin.MethodsDatacap.TransferExported),
+				MultisigParamsKey:  datacapTransferParsed,
+				MultisigTxnIDKey:   int64(9),
+				MultisigAppliedKey: false,
+			},
+		},
+		{
+			name:   "FailedProposeUnparsed",
+			method: "Propose",
+			params: encode(sendProposal),
+			want: map[string]interface{}{
+				MultisigToKey:     mockTo.String(),
+				MultisigValueKey:  "100",
+				MultisigMethodKey: uint64(builtin.MethodSend),
+			},
+		},
+		{
+			name:         "ApproveApplied",
+			method:       "Approve",
+			parsedParams: marshal(txnID),
+			params:       encode(txnID),
+			ret:          encode(&multisig.ApproveReturn{Applied: true, Ret: []byte{}}),
+			want: map[string]interface{}{
+				MultisigTxnIDKey:   int64(7),
+				MultisigAppliedKey: true,
+			},
+			wantApplied: true,
+		},
+		{
+			name:   "Cancel",
+			method: "Cancel",
+			params: encode(txnID),
+			want: map[string]interface{}{
+				MultisigTxnIDKey: int64(7),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, applied, err := decodeMultisigTx(tt.method, tt.parsedParams, tt.params, tt.ret)
+			if err != nil {
+				t.Fatalf("decodeMultisigTx() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decodeMultisigTx() got = %v, want %v", got, tt.want)
+			}
+			if applied != tt.wantApplied {
+				t.Errorf("decodeMultisigTx() applied = %v, want %v", applied, tt.wantApplied)
+			}
+		})
+	}
+}
+
+func TestIsExecutedSend(t *testing.T) {
+	mockSigner, _ := address.NewFromString("t01001")
+	mockMsig, _ := address.NewFromString("t01002")
+	mockTo, _ := address.NewFromString("t01003")
+
+	trace := &filTypes.ExecutionTrace{
+		Msg: filTypes.MessageTrace{From: mockSigner, To: mockMsig, Method: builtin.MethodsMultisig.Approve},
+	}
+	send := &filTypes.ExecutionTrace{
+		Msg: filTypes.MessageTrace{From: mockMsig, To: mockTo, Method: builtin.MethodSend},
+	}
+	call := &filTypes.ExecutionTrace{
+		Msg: filTypes.MessageTrace{From: mockMsig, To: mockTo, Method: builtin.MethodsMiner.ChangeWorkerAddress},
+	}
+
+	if !isExecutedSend(trace, send) {
+		t.Errorf("isExecutedSend() = false for the send made by the multisig")
+	}
+	if isExecutedSend(trace, call) {
+		t.Errorf("isExecutedSend() = true for a call to another method")
+	}
+}
@@ -7,6 +7,9 @@ import (
 	"github.com/coinbase/rosetta-sdk-go/types"
 	"github.com/filecoin-project/lotus/api"
 	filTypes "github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/node/modules/dtypes"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/zondax/rosetta-filecoin-proxy/rosetta/tools"
 )
 
 // NetworkAPIService implements the server.NetworkAPIServicer interface.
@@ -31,9 +34,19 @@ func (s *NetworkAPIService) NetworkList(
 	ctx context.Context,
 	request *types.MetadataRequest,
 ) (*types.NetworkListResponse, *types.Error) {
-	networkName, err := s.node.StateNetworkName(ctx)
+	ctx = withEndpoint(ctx, NetworkListEndpoint)
+
+	if s.node == nil {
+		return &types.NetworkListResponse{
+			NetworkIdentifiers: []*types.NetworkIdentifier{s.network},
+		}, nil
+	}
+
+	networkName, err := tools.LotusCall(ctx, lotusCallTimeout(ctx), func(ctx context.Context) (dtypes.NetworkName, error) {
+		return s.node.StateNetworkName(ctx)
+	})
 	if err != nil {
-		return nil, ErrUnableToGetChainID
+		return nil, BuildLotusError(ErrUnableToGetChainID, err, true)
 	}
 
 	resp := &types.NetworkListResponse{
@@ -53,6 +66,7 @@ func (s *NetworkAPIService) NetworkStatus(
 	ctx context.Context,
 	request *types.NetworkRequest,
 ) (*types.NetworkStatusResponse, *types.Error) {
+	ctx = withEndpoint(ctx, NetworkStatusEndpoint)
 
 	var (
 		headTipSet       *filTypes.TipSet
@@ -60,6 +74,10 @@ func (s *NetworkAPIService) NetworkStatus(
 		useGenesisTipSet = false
 	)
 
+	if s.node == nil {
+		return nil, ErrOfflineMode
+	}
+
 	// Check sync status
 	status, syncErr := CheckSyncStatus(ctx, &s.node)
 	if syncErr != nil {
@@ -82,10 +100,23 @@ func (s *NetworkAPIService) NetworkStatus(
 	}
 
 	// Get head TipSet
-	headTipSet, err = s.node.ChainHead(ctx)
+	headTipSet, err = tools.LotusCall(ctx, lotusCallTimeout(ctx), func(ctx context.Context) (*filTypes.TipSet, error) {
+		return s.node.ChainHead(ctx)
+	})
 
 	if err != nil || headTipSet == nil {
-		return nil, BuildError(ErrUnableToGetLatestBlk, err, true)
+		return nil, BuildLotusError(ErrUnableToGetLatestBlk, err, true)
+	}
+
+	// Clients following the tip only see the tipsets below the safe head
+	headTipSet, err = safeHeadOf(ctx, s.node, headTipSet)
+	if err != nil {
+		return nil, BuildLotusError(ErrUnableToGetLatestBlk, err, true)
+	}
+	if safeHeadEnabled() && status.IsSynced() {
+		// The sync progress is reported up to the safe head as well, like the current block
+		safeHeadIndex := int64(headTipSet.Height())
+		syncStatus.CurrentIndex = &safeHeadIndex
 	}
 
 	hashHeadTipSet, err := BuildTipSetKeyHash(headTipSet.Key())
@@ -94,9 +125,11 @@ func (s *NetworkAPIService) NetworkStatus(
 	}
 
 	// Get genesis TipSet
-	genesisTipSet, err := s.node.ChainGetGenesis(ctx)
+	genesisTipSet, err := tools.LotusCall(ctx, lotusCallTimeout(ctx), func(ctx context.Context) (*filTypes.TipSet, error) {
+		return s.node.ChainGetGenesis(ctx)
+	})
 	if err != nil || genesisTipSet == nil {
-		return nil, BuildError(ErrUnableToGetGenesisBlk, err, true)
+		return nil, BuildLotusError(ErrUnableToGetGenesisBlk, err, true)
 	}
 
 	hashGenesisTipSet, err := BuildTipSetKeyHash(genesisTipSet.Key())
@@ -105,12 +138,17 @@ func (s *NetworkAPIService) NetworkStatus(
 	}
 
 	// Get peers data
-	peersFil, err := s.node.NetPeers(ctx)
+	peersFil, err := tools.LotusCall(ctx, lotusCallTimeout(ctx), func(ctx context.Context) ([]peer.AddrInfo, error) {
+		return s.node.NetPeers(ctx)
+	})
 	if err != nil {
-		return nil, BuildError(ErrUnableToGetPeers, err, true)
+		return nil, BuildLotusError(ErrUnableToGetPeers, err, true)
 	}
 
 	var peers []*types.Peer
+	if nodePeer := s.getNodePeer(ctx); nodePeer != nil {
+		peers = append(peers, nodePeer)
+	}
 	for _, peerFil := range peersFil {
 		peers = append(peers, &types.Peer{
 			PeerID: peerFil.ID.String(),
@@ -150,21 +188,64 @@ func (s *NetworkAPIService) NetworkStatus(
 	return s.response, nil
 }
 
+// getNodePeer returns the Lotus node itself as a peer, with the latest finalized tipset in its
+// metadata, as the /network/status response has no other room for it. It's nil if the ID of the
+// node can't be retrieved.
+func (s *NetworkAPIService) getNodePeer(ctx context.Context) *types.Peer {
+	id, err := tools.LotusCall(ctx, lotusCallTimeout(ctx), func(ctx context.Context) (peer.ID, error) {
+		return s.node.ID(ctx)
+	})
+	if err != nil {
+		Logger.Warnf("could not get the ID of the Lotus node: %s", err.Error())
+		return nil
+	}
+	nodePeer := &types.Peer{PeerID: id.String()}
+
+	finality, err := getFinality(ctx, s.node)
+	if err != nil {
+		// The status is still useful without the finality
+		Logger.Warnf("could not get the latest finalized tipset: %s", err.Error())
+		return nodePeer
+	}
+	hash, err := BuildTipSetKeyHash(finality.TipSetKey)
+	if err != nil {
+		Logger.Warnf("could not build the hash of the latest finalized tipset: %s", err.Error())
+		return nodePeer
+	}
+	nodePeer.Metadata = map[string]interface{}{
+		FinalizedBlockKey: &types.BlockIdentifier{
+			Index: int64(finality.Height),
+			Hash:  *hash,
+		},
+		FinalitySourceKey: finality.Source,
+	}
+
+	return nodePeer
+}
+
 // NetworkOptions implements the /network/options endpoint.
 func (s *NetworkAPIService) NetworkOptions(
 	ctx context.Context,
 	request *types.NetworkRequest,
 ) (*types.NetworkOptionsResponse, *types.Error) {
+	ctx = withEndpoint(ctx, NetworkOptionsEndpoint)
 
-	version, err := s.node.Version(ctx)
-	if err != nil {
-		return nil, BuildError(ErrUnableToGetNodeInfo, err, false)
+	// Report the Lotus version the proxy was built with when running offline
+	nodeVersion := LotusVersion
+	if s.node != nil {
+		version, err := tools.LotusCall(ctx, lotusCallTimeout(ctx), func(ctx context.Context) (api.APIVersion, error) {
+			return s.node.Version(ctx)
+		})
+		if err != nil {
+			return nil, BuildLotusError(ErrUnableToGetNodeInfo, err, false)
+		}
+		nodeVersion = version.Version
 	}
 
 	return &types.NetworkOptionsResponse{
 		Version: &types.Version{
 			RosettaVersion: RosettaSDKVersion,
-			NodeVersion:    version.Version,
+			NodeVersion:    nodeVersion,
 		},
 		Allow: &types.Allow{
 			HistoricalBalanceLookup: true,
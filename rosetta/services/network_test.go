@@ -4,7 +4,12 @@ import (
 	"context"
 	"github.com/coinbase/rosetta-sdk-go/server"
 	"github.com/coinbase/rosetta-sdk-go/types"
+	"github.com/filecoin-project/go-state-types/abi"
 	"github.com/filecoin-project/lotus/api"
+	filTypes "github.com/filecoin-project/lotus/chain/types"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/mock"
+	mocks "github.com/zondax/rosetta-filecoin-proxy/rosetta/services/mocks"
 	"reflect"
 	"testing"
 )
@@ -134,3 +139,53 @@ func TestNewNetworkAPIService(t *testing.T) {
 		})
 	}
 }
+
+func TestNetworkStatusReportsFinality(t *testing.T) {
+	chain := buildMockChain(1000)
+	nodeID, _ := peer.Decode("12D3KooWGzxzKZYveHXtpG6AsrUJBcWxHBFS2HsEoGTxrMLvKXtf")
+
+	nodeMock := mocks.FullNode{}
+	nodeMock.On("SyncState", mock.Anything).
+		Return(&api.SyncState{
+			ActiveSyncs: []api.ActiveSync{
+				{
+					Stage:  api.StageSyncComplete,
+					Height: 1000,
+					Target: chain[1000],
+				},
+			},
+		}, nil)
+	nodeMock.On("ChainHead", mock.Anything).
+		Return(chain[1000], nil)
+	nodeMock.On("ChainGetGenesis", mock.Anything).
+		Return(chain[0], nil)
+	nodeMock.On("ChainGetTipSetByHeight", mock.Anything, mock.Anything, mock.Anything).
+		Return(func(ctx context.Context, height abi.ChainEpoch, tsk filTypes.TipSetKey) *filTypes.TipSet {
+			return chain[height]
+		}, nil)
+	nodeMock.On("NetPeers", mock.Anything).
+		Return([]peer.AddrInfo{}, nil)
+	nodeMock.On("ID", mock.Anything).
+		Return(nodeID, nil)
+	nodeMock.On("F3IsRunning", mock.Anything).
+		Return(false, nil)
+
+	s := &NetworkAPIService{network: NetworkID, node: &nodeMock}
+	got, err := s.NetworkStatus(context.Background(), &types.NetworkRequest{NetworkIdentifier: NetworkID})
+	if err != nil {
+		t.Fatalf("NetworkStatus() error = %v", err)
+	}
+
+	// The Lotus node is listed as the first peer, with the tipset finalized under EC
+	finalizedHash, _ := BuildTipSetKeyHash(chain[100].Key())
+	want := &types.Peer{
+		PeerID: nodeID.String(),
+		Metadata: map[string]interface{}{
+			FinalizedBlockKey: &types.BlockIdentifier{Index: 100, Hash: *finalizedHash},
+			FinalitySourceKey: FinalitySourceEC,
+		},
+	}
+	if len(got.Peers) != 1 || !reflect.DeepEqual(got.Peers[0], want) {
+		t.Errorf("NetworkStatus() peers = %v, want %v", got.Peers, want)
+	}
+}
@@ -0,0 +1,57 @@
+package services
+
+import (
+	"context"
+
+	"github.com/coinbase/rosetta-sdk-go/types"
+)
+
+// OfflineAPIService answers the endpoints that require chain access when
+// the proxy runs without a Lotus node. It implements the server.AccountAPIServicer,
+// server.BlockAPIServicer and server.MempoolAPIServicer interfaces.
+type OfflineAPIService struct {
+	network *types.NetworkIdentifier
+}
+
+// NewOfflineAPIService creates a new instance of an OfflineAPIService.
+func NewOfflineAPIService(network *types.NetworkIdentifier) *OfflineAPIService {
+	return &OfflineAPIService{
+		network: network,
+	}
+}
+
+// AccountBalance implements the /account/balance endpoint.
+func (o *OfflineAPIService) AccountBalance(ctx context.Context,
+	request *types.AccountBalanceRequest) (*types.AccountBalanceResponse, *types.Error) {
+	return nil, ErrOfflineMode
+}
+
+// AccountCoins implements the /account/coins endpoint.
+func (o *OfflineAPIService) AccountCoins(ctx context.Context,
+	request *types.AccountCoinsRequest) (*types.AccountCoinsResponse, *types.Error) {
+	return nil, ErrOfflineMode
+}
+
+// Block implements the /block endpoint.
+func (o *OfflineAPIService) Block(ctx context.Context,
+	request *types.BlockRequest) (*types.BlockResponse, *types.Error) {
+	return nil, ErrOfflineMode
+}
+
+// BlockTransaction implements the /block/transaction endpoint.
+func (o *OfflineAPIService) BlockTransaction(ctx context.Context,
+	request *types.BlockTransactionRequest) (*types.BlockTransactionResponse, *types.Error) {
+	return nil, ErrOfflineMode
+}
+
+// Mempool implements the /mempool endpoint.
+func (o *OfflineAPIService) Mempool(ctx context.Context,
+	request *types.NetworkRequest) (*types.MempoolResponse, *types.Error) {
+	return nil, ErrOfflineMode
+}
+
+// MempoolTransaction implements the /mempool/transaction endpoint.
+func (o *OfflineAPIService) MempoolTransaction(ctx context.Context,
+	request *types.MempoolTransactionRequest) (*types.MempoolTransactionResponse, *types.Error) {
+	return nil, ErrOfflineMode
+}
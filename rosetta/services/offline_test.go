@@ -0,0 +1,63 @@
+package services
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/coinbase/rosetta-sdk-go/types"
+)
+
+func TestOfflineAPIService(t *testing.T) {
+	o := NewOfflineAPIService(NetworkID)
+	ctx := context.Background()
+
+	_, err := o.AccountBalance(ctx, &types.AccountBalanceRequest{NetworkIdentifier: NetworkID})
+	if !reflect.DeepEqual(err, ErrOfflineMode) {
+		t.Errorf("AccountBalance() got = %v, want %v", err, ErrOfflineMode)
+	}
+
+	_, err = o.Block(ctx, &types.BlockRequest{NetworkIdentifier: NetworkID})
+	if !reflect.DeepEqual(err, ErrOfflineMode) {
+		t.Errorf("Block() got = %v, want %v", err, ErrOfflineMode)
+	}
+
+	_, err = o.Mempool(ctx, &types.NetworkRequest{NetworkIdentifier: NetworkID})
+	if !reflect.DeepEqual(err, ErrOfflineMode) {
+		t.Errorf("Mempool() got = %v, want %v", err, ErrOfflineMode)
+	}
+}
+
+func TestOfflineOnlineOnlyEndpoints(t *testing.T) {
+	ctx := context.Background()
+
+	c := &ConstructionAPIService{
+		network:    NetworkID,
+		rosettaLib: rosettaLib,
+	}
+	_, err := c.ConstructionMetadata(ctx, &types.ConstructionMetadataRequest{NetworkIdentifier: NetworkID})
+	if !reflect.DeepEqual(err, ErrOfflineMode) {
+		t.Errorf("ConstructionMetadata() got = %v, want %v", err, ErrOfflineMode)
+	}
+
+	_, err = c.ConstructionSubmit(ctx, &types.ConstructionSubmitRequest{NetworkIdentifier: NetworkID})
+	if !reflect.DeepEqual(err, ErrOfflineMode) {
+		t.Errorf("ConstructionSubmit() got = %v, want %v", err, ErrOfflineMode)
+	}
+
+	s := &NetworkAPIService{
+		network: NetworkID,
+	}
+	list, err := s.NetworkList(ctx, &types.MetadataRequest{})
+	if err != nil {
+		t.Fatalf("NetworkList() error = %v", err)
+	}
+	if !reflect.DeepEqual(list.NetworkIdentifiers, []*types.NetworkIdentifier{NetworkID}) {
+		t.Errorf("NetworkList() got = %v, want %v", list.NetworkIdentifiers, NetworkID)
+	}
+
+	_, err = s.NetworkStatus(ctx, &types.NetworkRequest{NetworkIdentifier: NetworkID})
+	if !reflect.DeepEqual(err, ErrOfflineMode) {
+		t.Errorf("NetworkStatus() got = %v, want %v", err, ErrOfflineMode)
+	}
+}
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/filecoin-project/go-state-types/builtin"
+	"github.com/filecoin-project/go-state-types/builtin/v17/paych"
+	filTypes "github.com/filecoin-project/lotus/chain/types"
+	"github.com/zondax/rosetta-filecoin-lib/actors"
+)
+
+// Payment channel operations
+const (
+	// OpPaychCreate funds a new payment channel, from the init actor
+	OpPaychCreate = "PaychCreate"
+	// OpPaychRedeemVoucher submits a voucher to a payment channel, moving no funds until it's collected
+	OpPaychRedeemVoucher = "PaychRedeemVoucher"
+	// OpPaychSettle starts the settling period of a payment channel
+	OpPaychSettle = "PaychSettle"
+	// OpPaychCollect pays out a settled payment channel to its recipient and sender
+	OpPaychCollect = "PaychCollect"
+)
+
+// Names of the keys in the Metadata map of payment channel operations
+const (
+	// PaychFromKey specifies the sender (payer) of a new payment channel.
+	PaychFromKey = "channelFrom"
+	// PaychToKey specifies the recipient (payee) of a new payment channel.
+	PaychToKey = "channelTo"
+	// PaychLaneKey specifies the lane of a redeemed voucher.
+	PaychLaneKey = "lane"
+	// PaychNonceKey specifies the nonce of a redeemed voucher in its lane.
+	PaychNonceKey = "nonce"
+	// PaychVoucherAmountKey specifies the amount of a redeemed voucher, in attoFIL. It's the
+	// total redeemable in its lane, not what this voucher adds to it.
+	PaychVoucherAmountKey = "voucherAmount"
+)
+
+// invokedActorName returns the name of the actor called by trace, preferring the code given by
+// the trace itself, as payment channels no longer exist once collected
+func (s *BlockAPIService) invokedActorName(ctx context.Context, trace *filTypes.ExecutionTrace, tipSet *filTypes.TipSet) string {
+	if trace.InvokedActor != nil {
+		if name, err := s.rosettaLib.BuiltinActors.GetActorNameFromCid(trace.InvokedActor.State.Code); err == nil {
+			return name
+		}
+	}
+	return GetActorNameFromAddress(ctx, trace.Msg.To, s.rosettaLib, tipSet)
+}
+
+// isPaychCreation tells whether trace is the call of the init actor constructing a payment channel
+func (s *BlockAPIService) isPaychCreation(ctx context.Context, trace *filTypes.ExecutionTrace, tipSet *filTypes.TipSet) bool {
+	return trace.Msg.From == builtin.InitActorAddr &&
+		s.invokedActorName(ctx, trace, tipSet) == actors.ActorPaymentChannelName
+}
+
+// decodePaychConstructor returns the metadata of the creation of a payment channel
+func decodePaychConstructor(params []byte) (map[string]interface{}, error) {
+	var p paych.ConstructorParams
+	if err := p.UnmarshalCBOR(bytes.NewReader(params)); err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		PaychFromKey: p.From.String(),
+		PaychToKey:   p.To.String(),
+	}, nil
+}
+
+// decodeVoucher returns the metadata of the voucher submitted by an UpdateChannelState call
+func decodeVoucher(params []byte) (map[string]interface{}, error) {
+	var p paych.UpdateChannelStateParams
+	if err := p.UnmarshalCBOR(bytes.NewReader(params)); err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		PaychLaneKey:          p.Sv.Lane,
+		PaychNonceKey:         p.Sv.Nonce,
+		PaychVoucherAmountKey: p.Sv.Amount.String(),
+	}, nil
+}
@@ -0,0 +1,155 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/coinbase/rosetta-sdk-go/types"
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/builtin"
+	"github.com/filecoin-project/go-state-types/builtin/v17/paych"
+	"github.com/filecoin-project/go-state-types/network"
+	"github.com/filecoin-project/lotus/api"
+	filTypes "github.com/filecoin-project/lotus/chain/types"
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/mock"
+	rosettaFilecoinLib "github.com/zondax/rosetta-filecoin-lib"
+	"github.com/zondax/rosetta-filecoin-lib/actors"
+	mocks "github.com/zondax/rosetta-filecoin-proxy/rosetta/services/mocks"
+	"github.com/zondax/rosetta-filecoin-proxy/rosetta/tools"
+)
+
+func TestProcessTracePaych(t *testing.T) {
+	mockPayer, _ := address.NewFromString("t01001")
+	mockChannel, _ := address.NewFromString("t01002")
+	mockPayee, _ := address.NewFromString("t01003")
+	mockTipSet := buildMockTargetTipSet(100)
+	paychCode, _ := cid.Parse("bafk2bzacebalad3f72wyk7qyilvfjijcwubdspytnyzlrhvn73254gqis44rq")
+
+	constructorBuf := new(bytes.Buffer)
+	_ = (&paych.ConstructorParams{From: mockPayer, To: mockPayee}).MarshalCBOR(constructorBuf)
+	voucherBuf := new(bytes.Buffer)
+	_ = (&paych.UpdateChannelStateParams{
+		Sv: paych.SignedVoucher{
+			ChannelAddr: mockChannel,
+			Lane:        1,
+			Nonce:       2,
+			Amount:      abi.NewTokenAmount(70),
+		},
+	}).MarshalCBOR(voucherBuf)
+
+	nodeMock := mocks.FullNode{}
+	nodeMock.On("StateGetActor", mock.Anything, mockChannel, mock.Anything).
+		Return(&filTypes.Actor{Code: paychCode}, nil)
+	nodeMock.On("StateGetActor", mock.Anything, mock.Anything, mock.Anything).
+		Return(nil, fmt.Errorf("actor not found"))
+	nodeMock.On("StateAccountKey", mock.Anything, mock.Anything, mock.Anything).
+		Return(address.Undef, fmt.Errorf("actor not found"))
+
+	var db tools.Database = &tools.Cache{}
+	var node api.FullNode = &nodeMock
+	db.NewImpl(&node)
+	tools.ActorsDB = db
+
+	lib := &rosettaFilecoinLib.RosettaConstructionFilecoin{
+		BuiltinActors: actors.BuiltinActors{
+			Metadata: actors.BuiltinActorsMetadata{
+				Version: network.Version25,
+				ActorsNameCidMapByVersion: map[network.Version]actors.ActorCidMap{
+					network.Version25: {actors.ActorPaymentChannelName: paychCode},
+				},
+			},
+		},
+	}
+	s := &BlockAPIService{node: &nodeMock, rosettaLib: lib}
+
+	opStatus := OperationStatusOk
+	createMd := map[string]interface{}{PaychFromKey: mockPayer.String(), PaychToKey: mockPayee.String()}
+	voucherMd := map[string]interface{}{PaychLaneKey: uint64(1), PaychNonceKey: uint64(2), PaychVoucherAmountKey: "70"}
+
+	tests := []struct {
+		name  string
+		trace filTypes.ExecutionTrace
+		want  func() []*types.Operation
+	}{
+		{
+			name: "Create",
+			trace: filTypes.ExecutionTrace{
+				Msg: filTypes.MessageTrace{
+					From:   builtin.InitActorAddr,
+					To:     mockChannel,
+					Value:  abi.NewTokenAmount(100),
+					Method: builtin.MethodConstructor,
+					Params: constructorBuf.Bytes(),
+				},
+				InvokedActor: &filTypes.ActorTrace{State: filTypes.Actor{Code: paychCode}},
+			},
+			want: func() []*types.Operation {
+				var ops []*types.Operation
+				ops = appendOp(ops, OpPaychCreate, builtin.InitActorAddr.String(), "-100", opStatus, false)
+				ops[0].Metadata = createMd
+				ops = appendOp(ops, OpPaychCreate, mockChannel.String(), "100", opStatus, true)
+				ops[1].Metadata = createMd
+				return ops
+			},
+		},
+		{
+			name: "RedeemVoucher",
+			trace: filTypes.ExecutionTrace{
+				Msg: filTypes.MessageTrace{
+					From:   mockPayee,
+					To:     mockChannel,
+					Value:  abi.NewTokenAmount(0),
+					Method: builtin.MethodsPaych.UpdateChannelState,
+					Params: voucherBuf.Bytes(),
+				},
+			},
+			want: func() []*types.Operation {
+				var ops []*types.Operation
+				ops = appendOp(ops, OpPaychRedeemVoucher, mockPayee.String(), "0", opStatus, false)
+				ops[0].Metadata = voucherMd
+				ops = appendOp(ops, OpPaychRedeemVoucher, mockChannel.String(), "0", opStatus, true)
+				ops[1].Metadata = voucherMd
+				return ops
+			},
+		},
+		{
+			name: "Collect",
+			trace: filTypes.ExecutionTrace{
+				Msg: filTypes.MessageTrace{
+					From:   mockPayer,
+					To:     mockChannel,
+					Value:  abi.NewTokenAmount(0),
+					Method: builtin.MethodsPaych.Collect,
+				},
+				Subcalls: []filTypes.ExecutionTrace{
+					{Msg: filTypes.MessageTrace{From: mockChannel, To: mockPayee, Value: abi.NewTokenAmount(70)}},
+					{Msg: filTypes.MessageTrace{From: mockChannel, To: mockPayer, Value: abi.NewTokenAmount(30)}},
+				},
+			},
+			want: func() []*types.Operation {
+				var ops []*types.Operation
+				ops = appendOp(ops, OpPaychCollect, mockPayer.String(), "0", opStatus, false)
+				ops = appendOp(ops, OpPaychCollect, mockChannel.String(), "0", opStatus, true)
+				ops = appendOp(ops, OpPaychCollect, mockChannel.String(), "-70", opStatus, false)
+				ops = appendOp(ops, OpPaychCollect, mockPayee.String(), "70", opStatus, true)
+				ops = appendOp(ops, OpPaychCollect, mockChannel.String(), "-30", opStatus, false)
+				ops = appendOp(ops, OpPaychCollect, mockPayer.String(), "30", opStatus, true)
+				return ops
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ops []*types.Operation
+			s.processTrace(context.Background(), &tt.trace, mockTipSet, &ops)
+			if want := tt.want(); !reflect.DeepEqual(ops, want) {
+				t.Errorf("processTrace() got = %v, want %v", ops, want)
+			}
+		})
+	}
+}
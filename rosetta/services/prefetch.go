@@ -0,0 +1,148 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/lotus/api"
+	filTypes "github.com/filecoin-project/lotus/chain/types"
+	lru "github.com/hashicorp/golang-lru/v2"
+	"github.com/zondax/rosetta-filecoin-proxy/rosetta/tools"
+	"golang.org/x/sync/singleflight"
+)
+
+// prefetchedState is the StateCompute output of the tipset with key tipSetKey
+type prefetchedState struct {
+	tipSetKey filTypes.TipSetKey
+	states    *api.ComputeStateOutput
+}
+
+// blockPrefetcher computes the state of the tipsets following the requested ones in the
+// background, as syncing clients request blocks sequentially. After a block at height N
+// is requested, the heights N+1..N+depth are computed, at most concurrency at a time.
+type blockPrefetcher struct {
+	node  api.FullNode
+	depth int
+	// slots bounds the StateCompute calls made in the background
+	slots chan struct{}
+	// states holds the computed states by height. The tipset key is checked on lookup,
+	// so the states of tipsets reverted by a reorg are never returned.
+	states *lru.Cache[abi.ChainEpoch, prefetchedState]
+	// calls merges the requests and prefetches computing the same tipset
+	calls singleflight.Group
+
+	mu        sync.Mutex
+	scheduled map[abi.ChainEpoch]bool
+}
+
+func newBlockPrefetcher(node api.FullNode, depth int, concurrency int) *blockPrefetcher {
+	// Keep room for the heights being served and prefetched at the same time
+	states, _ := lru.New[abi.ChainEpoch, prefetchedState](2*depth + concurrency)
+
+	return &blockPrefetcher{
+		node:      node,
+		depth:     depth,
+		slots:     make(chan struct{}, concurrency),
+		states:    states,
+		scheduled: make(map[abi.ChainEpoch]bool),
+	}
+}
+
+// stateCompute returns the StateCompute output of tipSet, computing it if it wasn't prefetched
+func (p *blockPrefetcher) stateCompute(ctx context.Context, tipSet *filTypes.TipSet) (*api.ComputeStateOutput, error) {
+	if states, ok := p.lookup(tipSet); ok {
+		return states, nil
+	}
+
+	// The computation is shared by every request for tipSet, so it isn't cancelled along with
+	// the one starting it. It's still bounded by the endpoint's timeout, kept in the context.
+	results := p.calls.DoChan(tipSet.Key().String(), func() (interface{}, error) {
+		states, err := getLotusStateCompute(context.WithoutCancel(ctx), &p.node, tipSet)
+		if err != nil {
+			return nil, err
+		}
+		p.states.Add(tipSet.Height(), prefetchedState{tipSetKey: tipSet.Key(), states: states})
+		return states, nil
+	})
+
+	// Each request only waits as long as its own context allows
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case result := <-results:
+		if result.Err != nil {
+			return nil, result.Err
+		}
+		return result.Val.(*api.ComputeStateOutput), nil
+	}
+}
+
+func (p *blockPrefetcher) lookup(tipSet *filTypes.TipSet) (*api.ComputeStateOutput, bool) {
+	prefetched, ok := p.states.Get(tipSet.Height())
+	if !ok || prefetched.tipSetKey != tipSet.Key() {
+		return nil, false
+	}
+	return prefetched.states, true
+}
+
+// prefetch computes in the background the heights following height which
+// aren't computed nor scheduled yet
+func (p *blockPrefetcher) prefetch(height abi.ChainEpoch) {
+	for next := height + 1; next <= height+abi.ChainEpoch(p.depth); next++ {
+		if p.states.Contains(next) || !p.schedule(next) {
+			continue
+		}
+
+		go func(height abi.ChainEpoch) {
+			defer p.unschedule(height)
+
+			p.slots <- struct{}{}
+			defer func() { <-p.slots }()
+
+			p.prefetchHeight(height)
+		}(next)
+	}
+}
+
+func (p *blockPrefetcher) prefetchHeight(height abi.ChainEpoch) {
+	defer TimeTrack(time.Now(), "[Proxy]Prefetch")
+
+	ctx := withEndpoint(context.Background(), BlockEndpoint)
+	tipSet, err := tools.LotusCall(ctx, lotusCallTimeout(ctx), func(ctx context.Context) (*filTypes.TipSet, error) {
+		return p.node.ChainGetTipSetByHeight(ctx, height, filTypes.EmptyTSK)
+	})
+	if err != nil {
+		// Most likely the height isn't reached yet
+		Logger.Debugf("could not prefetch height %d: %s", height, err.Error())
+		return
+	}
+
+	// Null rounds and the first heights have no transactions to compute, see Block
+	if tipSet.Height() != height || height <= 1 {
+		return
+	}
+
+	if _, err := p.stateCompute(ctx, tipSet); err != nil {
+		Logger.Debugf("could not prefetch height %d: %s", height, err.Error())
+	}
+}
+
+func (p *blockPrefetcher) schedule(height abi.ChainEpoch) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.scheduled[height] {
+		return false
+	}
+	p.scheduled[height] = true
+	return true
+}
+
+func (p *blockPrefetcher) unschedule(height abi.ChainEpoch) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.scheduled, height)
+}
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/coinbase/rosetta-sdk-go/types"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/lotus/api"
+	filTypes "github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/node/modules/dtypes"
+	"github.com/stretchr/testify/mock"
+	mocks "github.com/zondax/rosetta-filecoin-proxy/rosetta/services/mocks"
+)
+
+func TestBlockPrefetcher(t *testing.T) {
+	nodeMock := mocks.FullNode{}
+	mockStates := &api.ComputeStateOutput{}
+
+	nodeMock.On("ChainGetTipSetByHeight", mock.Anything, mock.Anything, mock.Anything).
+		Return(func(ctx context.Context, height abi.ChainEpoch, tsk filTypes.TipSetKey) *filTypes.TipSet {
+			return buildMockTargetTipSet(int64(height))
+		}, nil)
+	nodeMock.On("StateCompute", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Return(mockStates, nil)
+
+	prefetcher := newBlockPrefetcher(&nodeMock, 2, 1)
+	prefetcher.prefetch(100)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !(prefetcher.states.Contains(101) && prefetcher.states.Contains(102)) {
+		if time.Now().After(deadline) {
+			t.Fatal("heights 101 and 102 were not prefetched")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	nodeMock.AssertNumberOfCalls(t, "StateCompute", 2)
+
+	// Prefetched states are served without calling Lotus again
+	states, err := prefetcher.stateCompute(context.Background(), buildMockTargetTipSet(101))
+	if err != nil {
+		t.Fatalf("stateCompute() error = %v", err)
+	}
+	if states != mockStates {
+		t.Errorf("stateCompute() got = %v, want %v", states, mockStates)
+	}
+	nodeMock.AssertNumberOfCalls(t, "StateCompute", 2)
+
+	// A different tipset at a prefetched height, e.g. after a reorg, is computed again
+	reorgTipSet := buildMockTargetTipSet(102)
+	reorgTipSet.Blocks()[0].Timestamp = 1
+	reorgTipSet, _ = filTypes.NewTipSet(reorgTipSet.Blocks())
+	if _, err = prefetcher.stateCompute(context.Background(), reorgTipSet); err != nil {
+		t.Fatalf("stateCompute() error = %v", err)
+	}
+	nodeMock.AssertNumberOfCalls(t, "StateCompute", 3)
+}
+
+func TestBlockWithInvalidHashIsNotPrefetched(t *testing.T) {
+	nodeMock := mocks.FullNode{}
+	nodeMock.On("StateNetworkName", mock.Anything).
+		Return(dtypes.NetworkName(NetworkID.Network), nil)
+	nodeMock.On("SyncState", mock.Anything).
+		Return(&api.SyncState{
+			ActiveSyncs: []api.ActiveSync{
+				{
+					Stage:  api.StageSyncComplete,
+					Target: &filTypes.TipSet{},
+				},
+			},
+		}, nil)
+	nodeMock.On("ChainGetTipSetByHeight", mock.Anything, mock.Anything, mock.Anything).
+		Return(buildMockTargetTipSet(100), nil)
+
+	s := &BlockAPIService{
+		network:     NetworkID,
+		node:        &nodeMock,
+		traceSource: newTraceSourceSelector(TraceSourceStateCompute),
+		prefetcher:  newBlockPrefetcher(&nodeMock, 2, 1),
+	}
+
+	var index int64 = 100
+	wrongHash := "0171a0e40220bb47c05c217eae793e828a9f5a48713470bf811cda2cb32f186c842d6af1d4ea"
+	_, err := s.Block(context.Background(), &types.BlockRequest{
+		NetworkIdentifier: NetworkID,
+		BlockIdentifier: &types.PartialBlockIdentifier{
+			Index: &index,
+			Hash:  &wrongHash,
+		},
+	})
+	if !reflect.DeepEqual(err, ErrInvalidHash) {
+		t.Fatalf("Block() error = %v, want %v", err, ErrInvalidHash)
+	}
+
+	// A request rejected by its hash doesn't start computing the following blocks
+	s.prefetcher.mu.Lock()
+	defer s.prefetcher.mu.Unlock()
+	if len(s.prefetcher.scheduled) != 0 {
+		t.Errorf("heights %v were prefetched", s.prefetcher.scheduled)
+	}
+}
+
+func TestSharedStateComputeOutlivesCancelledRequest(t *testing.T) {
+	mockStates := &api.ComputeStateOutput{}
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
+
+	// StateCompute fails if its context is cancelled before it's released
+	nodeMock := mocks.FullNode{}
+	nodeMock.On("StateCompute", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Return(func(ctx context.Context, _ abi.ChainEpoch, _ []*filTypes.Message, _ filTypes.TipSetKey) (*api.ComputeStateOutput, error) {
+			started <- struct{}{}
+			select {
+			case <-release:
+				return mockStates, nil
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		})
+
+	prefetcher := newBlockPrefetcher(&nodeMock, 0, 1)
+	tipSet := buildMockTargetTipSet(100)
+
+	ctx, cancel := context.WithCancel(withEndpoint(context.Background(), BlockEndpoint))
+	firstErr := make(chan error, 1)
+	go func() {
+		_, err := prefetcher.stateCompute(ctx, tipSet)
+		firstErr <- err
+	}()
+	<-started
+
+	second := make(chan *api.ComputeStateOutput, 1)
+	go func() {
+		states, err := prefetcher.stateCompute(withEndpoint(context.Background(), BlockEndpoint), tipSet)
+		if err != nil {
+			t.Errorf("stateCompute() error = %v", err)
+		}
+		second <- states
+	}()
+	// Let the second request join the computation
+	time.Sleep(50 * time.Millisecond)
+
+	// The request starting the computation gives up, the other one still gets its result
+	cancel()
+	if err := <-firstErr; !errors.Is(err, context.Canceled) {
+		t.Errorf("stateCompute() error = %v, want %v", err, context.Canceled)
+	}
+	close(release)
+	if states := <-second; states != mockStates {
+		t.Errorf("stateCompute() got = %v, want %v", states, mockStates)
+	}
+	nodeMock.AssertNumberOfCalls(t, "StateCompute", 1)
+}
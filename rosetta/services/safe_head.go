@@ -0,0 +1,65 @@
+package services
+
+import (
+	"context"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/lotus/api"
+	filTypes "github.com/filecoin-project/lotus/chain/types"
+	"github.com/zondax/rosetta-filecoin-proxy/rosetta/tools"
+)
+
+// Safe head modes, see SafeHeadMode
+const (
+	// The chain's head is served as is
+	SafeHeadModeOff = "off"
+	// The tipset SafeHeadDepth epochs below the chain's head is served as the head
+	SafeHeadModeDepth = "depth"
+	// The latest finalized tipset is served as the head, see getFinality
+	SafeHeadModeFinalized = "finalized"
+)
+
+var SafeHeadModes = []string{SafeHeadModeOff, SafeHeadModeDepth, SafeHeadModeFinalized}
+
+// safeHeadEnabled reports whether the tipsets above the safe head are hidden from clients
+func safeHeadEnabled() bool {
+	return SafeHeadMode != SafeHeadModeOff
+}
+
+// getSafeHead returns the tipset served as the chain's head, see safeHeadOf
+func getSafeHead(ctx context.Context, node api.FullNode) (*filTypes.TipSet, error) {
+	head, err := tools.LotusCall(ctx, lotusCallTimeout(ctx), func(ctx context.Context) (*filTypes.TipSet, error) {
+		return node.ChainHead(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return safeHeadOf(ctx, node, head)
+}
+
+// safeHeadOf returns the tipset served as the chain's head when its actual head is head,
+// so clients following the tip never see tipsets reverted by a reorg
+func safeHeadOf(ctx context.Context, node api.FullNode, head *filTypes.TipSet) (*filTypes.TipSet, error) {
+	switch SafeHeadMode {
+	case SafeHeadModeDepth:
+		height := head.Height() - abi.ChainEpoch(SafeHeadDepth)
+		if height < 0 {
+			height = 0
+		}
+		// On null rounds, the previous tipset is returned
+		return tools.LotusCall(ctx, lotusCallTimeout(ctx), func(ctx context.Context) (*filTypes.TipSet, error) {
+			return node.ChainGetTipSetByHeight(ctx, height, head.Key())
+		})
+	case SafeHeadModeFinalized:
+		finality, err := getFinality(ctx, node)
+		if err != nil {
+			return nil, err
+		}
+		return tools.LotusCall(ctx, lotusCallTimeout(ctx), func(ctx context.Context) (*filTypes.TipSet, error) {
+			return node.ChainGetTipSet(ctx, finality.TipSetKey)
+		})
+	default:
+		return head, nil
+	}
+}
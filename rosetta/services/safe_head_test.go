@@ -0,0 +1,99 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/coinbase/rosetta-sdk-go/types"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/lotus/api"
+	filTypes "github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/node/modules/dtypes"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/mock"
+	mocks "github.com/zondax/rosetta-filecoin-proxy/rosetta/services/mocks"
+)
+
+func TestSafeHead(t *testing.T) {
+	chain := buildMockChain(1000)
+
+	nodeMock := mocks.FullNode{}
+	nodeMock.On("StateNetworkName", mock.Anything).
+		Return(dtypes.NetworkName(NetworkID.Network), nil)
+	nodeMock.On("SyncState", mock.Anything).
+		Return(&api.SyncState{
+			ActiveSyncs: []api.ActiveSync{
+				{
+					Stage:  api.StageSyncComplete,
+					Height: 1000,
+					Target: chain[1000],
+				},
+			},
+		}, nil)
+	nodeMock.On("ChainHead", mock.Anything).Return(chain[1000], nil)
+	nodeMock.On("ChainGetTipSetByHeight", mock.Anything, mock.Anything, mock.Anything).
+		Return(func(ctx context.Context, height abi.ChainEpoch, tsk filTypes.TipSetKey) *filTypes.TipSet {
+			return chain[height]
+		}, nil)
+	nodeMock.On("ChainGetTipSet", mock.Anything, mock.Anything).
+		Return(func(ctx context.Context, key filTypes.TipSetKey) *filTypes.TipSet {
+			for _, tipSet := range chain {
+				if tipSet.Key() == key {
+					return tipSet
+				}
+			}
+			return nil
+		}, nil)
+	nodeMock.On("F3IsRunning", mock.Anything).Return(false, errors.New("f3 is disabled"))
+	nodeMock.On("ChainGetGenesis", mock.Anything).Return(chain[0], nil)
+	nodeMock.On("NetPeers", mock.Anything).Return([]peer.AddrInfo{}, nil)
+	nodeMock.On("ID", mock.Anything).Return(peer.ID(""), errors.New("no ID"))
+
+	defer func() { SafeHeadMode, SafeHeadDepth = SafeHeadModeOff, 0 }()
+
+	tests := []struct {
+		mode string
+		want abi.ChainEpoch
+	}{
+		{SafeHeadModeOff, 1000},
+		{SafeHeadModeDepth, 990},
+		{SafeHeadModeFinalized, 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			SafeHeadMode, SafeHeadDepth = tt.mode, 10
+
+			safeHead, err := getSafeHead(context.Background(), &nodeMock)
+			if err != nil {
+				t.Fatalf("getSafeHead() error = %v", err)
+			}
+			if safeHead.Height() != tt.want {
+				t.Errorf("getSafeHead() got = %d, want %d", safeHead.Height(), tt.want)
+			}
+		})
+	}
+
+	// Blocks above the safe head are rejected
+	SafeHeadMode = SafeHeadModeDepth
+	s := &BlockAPIService{network: NetworkID, node: &nodeMock}
+	requestedIndex := int64(995)
+	_, err := s.Block(context.Background(), &types.BlockRequest{
+		NetworkIdentifier: NetworkID,
+		BlockIdentifier:   &types.PartialBlockIdentifier{Index: &requestedIndex},
+	})
+	if err != ErrBlockNotConfirmed {
+		t.Errorf("Block() error = %v, want %v", err, ErrBlockNotConfirmed)
+	}
+
+	// The network status reports the safe head as the current block and sync progress
+	n := &NetworkAPIService{network: NetworkID, node: &nodeMock}
+	status, err := n.NetworkStatus(context.Background(), &types.NetworkRequest{NetworkIdentifier: NetworkID})
+	if err != nil {
+		t.Fatalf("NetworkStatus() error = %v", err)
+	}
+	if status.CurrentBlockIdentifier.Index != 990 || *status.SyncStatus.CurrentIndex != 990 {
+		t.Errorf("NetworkStatus() got current block %d and index %d, want 990",
+			status.CurrentBlockIdentifier.Index, *status.SyncStatus.CurrentIndex)
+	}
+}
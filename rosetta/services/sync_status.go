@@ -4,6 +4,7 @@ import (
 	"context"
 	"github.com/coinbase/rosetta-sdk-go/types"
 	"github.com/filecoin-project/lotus/api"
+	"github.com/zondax/rosetta-filecoin-proxy/rosetta/tools"
 	"math"
 )
 
@@ -76,10 +77,12 @@ func (status SyncStatus) GetTargetIndex() *int64 {
 func CheckSyncStatus(ctx context.Context, node *api.FullNode) (*SyncStatus, *types.Error) {
 
 	fullAPI := *node
-	syncState, err := fullAPI.SyncState(ctx)
+	syncState, err := tools.LotusCall(ctx, lotusCallTimeout(ctx), func(ctx context.Context) (*api.SyncState, error) {
+		return fullAPI.SyncState(ctx)
+	})
 
 	if err != nil || len(syncState.ActiveSyncs) == 0 {
-		return nil, BuildError(ErrUnableToGetSyncStatus, err, true)
+		return nil, BuildLotusError(ErrUnableToGetSyncStatus, err, true)
 	}
 
 	var (
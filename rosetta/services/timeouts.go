@@ -0,0 +1,74 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/zondax/rosetta-filecoin-proxy/rosetta/tools"
+)
+
+// Endpoints querying Lotus. Each of them can set its own timeout for Lotus calls
+const (
+	NetworkListEndpoint          = "/network/list"
+	NetworkStatusEndpoint        = "/network/status"
+	NetworkOptionsEndpoint       = "/network/options"
+	AccountBalanceEndpoint       = "/account/balance"
+	BlockEndpoint                = "/block"
+	BlockTransactionEndpoint     = "/block/transaction"
+	MempoolEndpoint              = "/mempool"
+	MempoolTransactionEndpoint   = "/mempool/transaction"
+	ConstructionMetadataEndpoint = "/construction/metadata"
+	ConstructionSubmitEndpoint   = "/construction/submit"
+)
+
+// LotusCallTimeOutEnvName is the env var that sets LotusCallTimeOut
+const LotusCallTimeOutEnvName = "LOTUS_CALL_TIMEOUT"
+
+var LotusEndpoints = []string{
+	NetworkListEndpoint,
+	NetworkStatusEndpoint,
+	NetworkOptionsEndpoint,
+	AccountBalanceEndpoint,
+	BlockEndpoint,
+	BlockTransactionEndpoint,
+	MempoolEndpoint,
+	MempoolTransactionEndpoint,
+	ConstructionMetadataEndpoint,
+	ConstructionSubmitEndpoint,
+}
+
+// LotusCallTimeOuts holds the timeout of the Lotus calls made by each endpoint.
+// Endpoints not present use LotusCallTimeOut.
+var LotusCallTimeOuts = map[string]time.Duration{}
+
+type endpointKey struct{}
+
+// LotusCallTimeOutEnvNameFor returns the env var that sets the Lotus calls timeout
+// of endpoint, e.g. LOTUS_CALL_TIMEOUT_ACCOUNT_BALANCE for /account/balance
+func LotusCallTimeOutEnvNameFor(endpoint string) string {
+	name := strings.ReplaceAll(strings.TrimPrefix(endpoint, "/"), "/", "_")
+	return LotusCallTimeOutEnvName + "_" + strings.ToUpper(name)
+}
+
+// withEndpoint tags ctx with the endpoint being served, so that
+// the Lotus calls made on its behalf use the endpoint's timeout
+func withEndpoint(ctx context.Context, endpoint string) context.Context {
+	return context.WithValue(ctx, endpointKey{}, endpoint)
+}
+
+// The actors database looks actors up with the timeout of the endpoint being served
+func init() {
+	tools.ActorLookupTimeOut = lotusCallTimeout
+}
+
+// lotusCallTimeout returns the timeout of the Lotus calls made while serving ctx
+func lotusCallTimeout(ctx context.Context) time.Duration {
+	if endpoint, ok := ctx.Value(endpointKey{}).(string); ok {
+		if timeout, ok := LotusCallTimeOuts[endpoint]; ok {
+			return timeout
+		}
+	}
+
+	return LotusCallTimeOut
+}
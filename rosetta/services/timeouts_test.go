@@ -0,0 +1,68 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/coinbase/rosetta-sdk-go/types"
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/node/modules/dtypes"
+	"github.com/stretchr/testify/mock"
+	mocks "github.com/zondax/rosetta-filecoin-proxy/rosetta/services/mocks"
+	"github.com/zondax/rosetta-filecoin-proxy/rosetta/tools"
+)
+
+func TestLotusCallTimeOutEnvNameFor(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		want     string
+	}{
+		{endpoint: BlockEndpoint, want: "LOTUS_CALL_TIMEOUT_BLOCK"},
+		{endpoint: AccountBalanceEndpoint, want: "LOTUS_CALL_TIMEOUT_ACCOUNT_BALANCE"},
+		{endpoint: MempoolTransactionEndpoint, want: "LOTUS_CALL_TIMEOUT_MEMPOOL_TRANSACTION"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.endpoint, func(t *testing.T) {
+			if got := LotusCallTimeOutEnvNameFor(tt.endpoint); got != tt.want {
+				t.Errorf("LotusCallTimeOutEnvNameFor() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEndpointLotusCallTimeOut(t *testing.T) {
+	LotusCallTimeOuts[AccountBalanceEndpoint] = 100 * time.Millisecond
+	defer delete(LotusCallTimeOuts, AccountBalanceEndpoint)
+
+	nodeMock := mocks.FullNode{}
+	// Answer as the RPC client does once the call is cancelled
+	nodeMock.On("StateNetworkName", mock.Anything).
+		Run(func(args mock.Arguments) {
+			<-args.Get(0).(context.Context).Done()
+		}).
+		Return(dtypes.NetworkName(""), context.DeadlineExceeded)
+	var node api.FullNode = &nodeMock
+
+	if got := lotusCallTimeout(withEndpoint(context.Background(), BlockEndpoint)); got != LotusCallTimeOut {
+		t.Errorf("lotusCallTimeout() = %v, want %v", got, LotusCallTimeOut)
+	}
+
+	// Actors are looked up with the timeout of the endpoint too
+	if got := tools.ActorLookupTimeOut(withEndpoint(context.Background(), AccountBalanceEndpoint)); got != 100*time.Millisecond {
+		t.Errorf("tools.ActorLookupTimeOut() = %v, want %v", got, 100*time.Millisecond)
+	}
+
+	a := NewAccountAPIService(NetworkID, &node, rosettaLib)
+	start := time.Now()
+	_, got := a.AccountBalance(context.Background(), &types.AccountBalanceRequest{
+		NetworkIdentifier: NetworkID,
+		AccountIdentifier: &types.AccountIdentifier{Address: "f01234"},
+	})
+	if got != ErrLotusCallTimedOut {
+		t.Errorf("AccountBalance() got1 = %v, want %v", got, ErrLotusCallTimedOut)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("AccountBalance() took %v, want less than %v", elapsed, time.Second)
+	}
+}
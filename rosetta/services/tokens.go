@@ -0,0 +1,278 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/coinbase/rosetta-sdk-go/types"
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/filecoin-project/lotus/api"
+	filTypes "github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/chain/types/ethtypes"
+	"github.com/ipfs/go-cid"
+	"github.com/zondax/rosetta-filecoin-proxy/rosetta/tools"
+)
+
+const (
+	// OpERC20Transfer is the type of the operations built from ERC-20 Transfer events
+	OpERC20Transfer = "ERC20Transfer"
+	// OpERC20Mint is the type of the operations built from ERC-20 Transfer events from the zero address
+	OpERC20Mint = "ERC20Mint"
+	// OpERC20Burn is the type of the operations built from ERC-20 Transfer events to the zero address
+	OpERC20Burn = "ERC20Burn"
+
+	// TokenContractKey is the key in the Metadata map of a token's Currency holding
+	// the address of its contract
+	TokenContractKey = "contractAddress"
+)
+
+// erc20TransferTopic is the keccak256 hash of "Transfer(address,address,uint256)"
+var erc20TransferTopic = []byte{
+	0xdd, 0xf2, 0x52, 0xad, 0x1b, 0xe2, 0xc8, 0x9b, 0x69, 0xc2, 0xb0, 0x68, 0xfc, 0x37, 0x8d, 0xaa,
+	0x95, 0x2b, 0xa7, 0xf1, 0x63, 0xc4, 0xa1, 0x16, 0x28, 0xf5, 0x5a, 0x4d, 0xf5, 0x23, 0xb3, 0xef,
+}
+
+// Tokens is set on startup when a token list is configured
+var Tokens *TokenRegistry
+
+// Token is an ERC-20 token whose transfers are reported in its own currency
+type Token struct {
+	// Address of the token's contract, an f410 or ID address
+	Contract address.Address
+	Symbol   string
+	Decimals int32
+}
+
+// ParseTokenContract parses the address of a token's contract, either as an Ethereum
+// address (0x...) or as an f410 or ID Filecoin address
+func ParseTokenContract(s string) (address.Address, error) {
+	if strings.HasPrefix(s, "0x") {
+		ethAddr, err := ethtypes.ParseEthAddress(s)
+		if err != nil {
+			return address.Undef, err
+		}
+		return ethAddr.ToFilecoinAddress()
+	}
+
+	addr, err := address.NewFromString(s)
+	if err != nil {
+		return address.Undef, err
+	}
+	if addr.Protocol() != address.ID && addr.Protocol() != address.Delegated {
+		return address.Undef, fmt.Errorf("%s is not an f410 nor an ID address", s)
+	}
+	return addr, nil
+}
+
+// Currency returns the currency of the token's amounts
+func (t *Token) Currency() *types.Currency {
+	contract := t.Contract.String()
+	if ethAddr, err := ethtypes.EthAddressFromFilecoinAddress(t.Contract); err == nil {
+		contract = ethAddr.String()
+	}
+
+	return &types.Currency{
+		Symbol:   t.Symbol,
+		Decimals: t.Decimals,
+		Metadata: map[string]interface{}{
+			TokenContractKey: contract,
+		},
+	}
+}
+
+// TokenRegistry finds the configured tokens by the ID of the actors emitting their events
+type TokenRegistry struct {
+	byContract map[address.Address]*Token
+
+	mu sync.Mutex
+	// emitters caches the token of each emitter seen, nil for those not configured
+	emitters map[abi.ActorID]*Token
+}
+
+func NewTokenRegistry(tokens []*Token) *TokenRegistry {
+	byContract := make(map[address.Address]*Token, len(tokens))
+	for _, token := range tokens {
+		byContract[token.Contract] = token
+	}
+
+	return &TokenRegistry{
+		byContract: byContract,
+		emitters:   make(map[abi.ActorID]*Token),
+	}
+}
+
+// tokenOf returns the token whose contract is the actor emitter, or nil if it isn't configured
+func (r *TokenRegistry) tokenOf(ctx context.Context, node api.FullNode, emitter abi.ActorID) (*Token, error) {
+	r.mu.Lock()
+	token, ok := r.emitters[emitter]
+	r.mu.Unlock()
+	if ok {
+		return token, nil
+	}
+
+	idAddr, err := address.NewIDAddress(uint64(emitter))
+	if err != nil {
+		return nil, err
+	}
+	token = r.byContract[idAddr]
+	if token == nil {
+		// EVM contracts are configured by their f410 address
+		actor, err := tools.LotusCall(ctx, lotusCallTimeout(ctx), func(ctx context.Context) (*filTypes.Actor, error) {
+			return node.StateGetActor(ctx, idAddr, filTypes.EmptyTSK)
+		})
+		if err != nil {
+			return nil, err
+		}
+		if actor.DelegatedAddress != nil {
+			token = r.byContract[*actor.DelegatedAddress]
+		}
+	}
+
+	r.mu.Lock()
+	r.emitters[emitter] = token
+	r.mu.Unlock()
+
+	return token, nil
+}
+
+// TokenTransfer is an ERC-20 Transfer event emitted by a configured token. From is
+// address.Undef for mints, and To for burns.
+type TokenTransfer struct {
+	Token  *Token
+	From   address.Address
+	To     address.Address
+	Amount big.Int
+}
+
+// getTokenTransfers returns the transfers of the configured tokens made by each message in
+// states, by message CID. Only successful messages emit events.
+func (s *BlockAPIService) getTokenTransfers(ctx context.Context, states *api.ComputeStateOutput) (map[cid.Cid][]*TokenTransfer, *types.Error) {
+	if Tokens == nil {
+		return nil, nil
+	}
+
+	transfers := make(map[cid.Cid][]*TokenTransfer)
+	for _, trace := range states.Trace {
+		if trace == nil || trace.MsgRct.EventsRoot == nil || !trace.MsgRct.ExitCode.IsSuccess() {
+			continue
+		}
+
+		eventsRoot := *trace.MsgRct.EventsRoot
+		events, err := tools.LotusCall(ctx, lotusCallTimeout(ctx), func(ctx context.Context) ([]filTypes.Event, error) {
+			return s.node.ChainGetEvents(ctx, eventsRoot)
+		})
+		if err != nil {
+			return nil, BuildLotusError(ErrUnableToGetEvents, err, true)
+		}
+
+		for _, event := range events {
+			from, to, amount, ok := decodeERC20Transfer(event)
+			if !ok {
+				continue
+			}
+			token, err := Tokens.tokenOf(ctx, s.node, event.Emitter)
+			if err != nil {
+				return nil, BuildLotusError(ErrUnableToGetEvents, err, true)
+			}
+			if token == nil {
+				continue
+			}
+
+			fromAddr, err1 := tokenHolder(from)
+			toAddr, err2 := tokenHolder(to)
+			if err1 != nil || err2 != nil {
+				Logger.Errorf("could not convert the addresses of a %s transfer: %s, %s", token.Symbol, from, to)
+				continue
+			}
+			transfers[trace.MsgCid] = append(transfers[trace.MsgCid], &TokenTransfer{
+				Token:  token,
+				From:   fromAddr,
+				To:     toAddr,
+				Amount: amount,
+			})
+		}
+	}
+
+	return transfers, nil
+}
+
+// decodeERC20Transfer decodes an ERC-20 Transfer(from, to, value) event, as logged by the
+// EVM actor: topics as the entries t1 to t3, and the value as the data entry d. ERC-721
+// Transfer events have the same signature but an indexed token id, in t4, instead of data.
+func decodeERC20Transfer(event filTypes.Event) (from, to ethtypes.EthAddress, amount big.Int, ok bool) {
+	entries := make(map[string][]byte, len(event.Entries))
+	for _, entry := range event.Entries {
+		entries[entry.Key] = entry.Value
+	}
+
+	if len(entries) != 4 || !bytes.Equal(entries["t1"], erc20TransferTopic) ||
+		len(entries["t2"]) != 32 || len(entries["t3"]) != 32 || len(entries["d"]) != 32 {
+		return from, to, amount, false
+	}
+
+	// Addresses are left padded to 32 bytes
+	copy(from[:], entries["t2"][12:])
+	copy(to[:], entries["t3"][12:])
+	amount = big.PositiveFromUnsignedBytes(entries["d"])
+
+	return from, to, amount, true
+}
+
+// tokenHolder returns the Filecoin address of a token holder, or address.Undef for the zero
+// address, which stands for the mints and burns of the token
+func tokenHolder(addr ethtypes.EthAddress) (address.Address, error) {
+	if addr == (ethtypes.EthAddress{}) {
+		return address.Undef, nil
+	}
+	return addr.ToFilecoinAddress()
+}
+
+// appendTokenOps appends the operations of the token transfers made by a message. Mints and
+// burns have a single operation, as the zero address isn't an account.
+func (s *BlockAPIService) appendTokenOps(ctx context.Context, ops []*types.Operation, transfers []*TokenTransfer,
+	tipSet *filTypes.TipSet) []*types.Operation {
+	for _, transfer := range transfers {
+		currency := transfer.Token.Currency()
+
+		switch {
+		case transfer.From == address.Undef && transfer.To == address.Undef:
+			continue
+		case transfer.From == address.Undef:
+			to := s.tokenAccount(ctx, transfer.To, tipSet)
+			ops = appendOp(ops, OpERC20Mint, to, transfer.Amount.String(), OperationStatusOk, false)
+			ops[len(ops)-1].Amount.Currency = currency
+		case transfer.To == address.Undef:
+			from := s.tokenAccount(ctx, transfer.From, tipSet)
+			ops = appendOp(ops, OpERC20Burn, from, transfer.Amount.Neg().String(), OperationStatusOk, false)
+			ops[len(ops)-1].Amount.Currency = currency
+		default:
+			from := s.tokenAccount(ctx, transfer.From, tipSet)
+			to := s.tokenAccount(ctx, transfer.To, tipSet)
+			ops = appendOp(ops, OpERC20Transfer, from, transfer.Amount.Neg().String(), OperationStatusOk, false)
+			ops[len(ops)-1].Amount.Currency = currency
+			ops = appendOp(ops, OpERC20Transfer, to, transfer.Amount.String(), OperationStatusOk, true)
+			ops[len(ops)-1].Amount.Currency = currency
+		}
+	}
+
+	return ops
+}
+
+// tokenAccount returns the account of a token holder. The holders without an Ethereum
+// address are given by their ID address, which is resolved like in FIL operations.
+func (s *BlockAPIService) tokenAccount(ctx context.Context, addr address.Address, tipSet *filTypes.TipSet) string {
+	if addr.Protocol() != address.ID {
+		return addr.String()
+	}
+
+	account, err := GetActorPubKey(ctx, addr, s.rosettaLib, tipSet)
+	if err != nil {
+		return addr.String()
+	}
+	return account
+}
@@ -0,0 +1,163 @@
+package services
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/coinbase/rosetta-sdk-go/types"
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/filecoin-project/go-state-types/exitcode"
+	"github.com/filecoin-project/lotus/api"
+	filTypes "github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/chain/types/ethtypes"
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/mock"
+	mocks "github.com/zondax/rosetta-filecoin-proxy/rosetta/services/mocks"
+)
+
+func buildMockTransferEvent(emitter abi.ActorID, from, to ethtypes.EthAddress, amount int64, tokenId bool) filTypes.Event {
+	topic := func(addr ethtypes.EthAddress) []byte {
+		return append(make([]byte, 12), addr[:]...)
+	}
+	value := make([]byte, 32)
+	big.NewInt(amount).Int.FillBytes(value)
+
+	entries := []filTypes.EventEntry{
+		{Key: "t1", Value: erc20TransferTopic},
+		{Key: "t2", Value: topic(from)},
+		{Key: "t3", Value: topic(to)},
+	}
+	if tokenId {
+		entries = append(entries, filTypes.EventEntry{Key: "t4", Value: value})
+	} else {
+		entries = append(entries, filTypes.EventEntry{Key: "d", Value: value})
+	}
+
+	return filTypes.Event{Emitter: emitter, Entries: entries}
+}
+
+func TestGetTokenTransfers(t *testing.T) {
+	mockEventsRoot, _ := cid.Parse("bafkqaaa")
+	mockMsgCid, _ := cid.Parse("bafy2bzacebpqu5wuaddffscppacgu2cxk75skzldo45atrhwbnl4fnvb2l75m")
+	mockFrom, _ := ethtypes.ParseEthAddress("0x1111111111111111111111111111111111111111")
+	mockTo, _ := ethtypes.ParseEthAddress("0xff00000000000000000000000000000000000bb8") // f03000
+	mockFromAddr, _ := mockFrom.ToFilecoinAddress()
+	mockToAddr, _ := address.NewIDAddress(3000)
+
+	usdfcContract, _ := ParseTokenContract("0x80b98d3aa09ffff255c3ba4a241111ff1262f045")
+	usdfc := &Token{Contract: usdfcContract, Symbol: "USDFC", Decimals: 18}
+	wfilContract, _ := ParseTokenContract("f01001")
+	wfil := &Token{Contract: wfilContract, Symbol: "WFIL", Decimals: 18}
+
+	Tokens = NewTokenRegistry([]*Token{usdfc, wfil})
+	defer func() { Tokens = nil }()
+
+	nodeMock := mocks.FullNode{}
+	nodeMock.On("ChainGetEvents", mock.Anything, mockEventsRoot).
+		Return([]filTypes.Event{
+			buildMockTransferEvent(1000, mockFrom, mockTo, 5, false),
+			buildMockTransferEvent(1001, mockTo, mockFrom, 7, false),
+			// A mint
+			buildMockTransferEvent(1000, ethtypes.EthAddress{}, mockTo, 3, false),
+			// An ERC-721 transfer
+			buildMockTransferEvent(1000, mockFrom, mockTo, 9, true),
+			// Not a configured token
+			buildMockTransferEvent(1002, mockFrom, mockTo, 11, false),
+		}, nil)
+	nodeMock.On("StateGetActor", mock.Anything, mock.Anything, mock.Anything).
+		Return(func(ctx context.Context, addr address.Address, tsk filTypes.TipSetKey) *filTypes.Actor {
+			if id, _ := address.IDFromAddress(addr); id == 1000 {
+				return &filTypes.Actor{DelegatedAddress: &usdfcContract}
+			}
+			return &filTypes.Actor{}
+		}, nil)
+
+	states := &api.ComputeStateOutput{
+		Trace: []*api.InvocResult{
+			{
+				MsgCid: mockMsgCid,
+				MsgRct: &filTypes.MessageReceipt{ExitCode: exitcode.Ok, EventsRoot: &mockEventsRoot},
+			},
+			{
+				// Failed messages emit no events
+				MsgCid: mockMsgCid,
+				MsgRct: &filTypes.MessageReceipt{ExitCode: exitcode.SysErrOutOfGas, EventsRoot: &mockEventsRoot},
+			},
+		},
+	}
+
+	s := &BlockAPIService{node: &nodeMock}
+	transfers, err := s.getTokenTransfers(context.Background(), states)
+	if err != nil {
+		t.Fatalf("getTokenTransfers() error = %v", err)
+	}
+	want := map[cid.Cid][]*TokenTransfer{
+		mockMsgCid: {
+			{Token: usdfc, From: mockFromAddr, To: mockToAddr, Amount: big.NewInt(5)},
+			{Token: wfil, From: mockToAddr, To: mockFromAddr, Amount: big.NewInt(7)},
+			{Token: usdfc, From: address.Undef, To: mockToAddr, Amount: big.NewInt(3)},
+		},
+	}
+	if !reflect.DeepEqual(transfers, want) {
+		t.Errorf("getTokenTransfers() got = %v, want %v", transfers, want)
+	}
+	nodeMock.AssertNumberOfCalls(t, "ChainGetEvents", 1)
+	// Emitters are looked up once
+	if _, err = s.getTokenTransfers(context.Background(), states); err != nil {
+		t.Fatalf("getTokenTransfers() error = %v", err)
+	}
+	nodeMock.AssertNumberOfCalls(t, "StateGetActor", 2)
+
+	currency := usdfc.Currency()
+	wantCurrency := &types.Currency{
+		Symbol:   "USDFC",
+		Decimals: 18,
+		Metadata: map[string]interface{}{TokenContractKey: "0x80b98d3aa09ffff255c3ba4a241111ff1262f045"},
+	}
+	if !reflect.DeepEqual(currency, wantCurrency) {
+		t.Errorf("Currency() got = %v, want %v", currency, wantCurrency)
+	}
+}
+
+func TestAppendTokenOps(t *testing.T) {
+	mockHolder, _ := ethtypes.ParseEthAddress("0x1111111111111111111111111111111111111111")
+	mockHolderAddr, _ := mockHolder.ToFilecoinAddress()
+	mockOther, _ := ethtypes.ParseEthAddress("0x2222222222222222222222222222222222222222")
+	mockOtherAddr, _ := mockOther.ToFilecoinAddress()
+	usdfcContract, _ := ParseTokenContract("0x80b98d3aa09ffff255c3ba4a241111ff1262f045")
+	usdfc := &Token{Contract: usdfcContract, Symbol: "USDFC", Decimals: 18}
+
+	s := &BlockAPIService{}
+	ops := s.appendTokenOps(context.Background(), nil, []*TokenTransfer{
+		{Token: usdfc, From: address.Undef, To: mockHolderAddr, Amount: big.NewInt(5)},
+		{Token: usdfc, From: mockHolderAddr, To: mockOtherAddr, Amount: big.NewInt(3)},
+		{Token: usdfc, From: mockOtherAddr, To: address.Undef, Amount: big.NewInt(2)},
+	}, nil)
+
+	// Mints and burns have no counterparty
+	want := []struct {
+		opType  string
+		account string
+		amount  string
+	}{
+		{OpERC20Mint, mockHolderAddr.String(), "5"},
+		{OpERC20Transfer, mockHolderAddr.String(), "-3"},
+		{OpERC20Transfer, mockOtherAddr.String(), "3"},
+		{OpERC20Burn, mockOtherAddr.String(), "-2"},
+	}
+	if len(ops) != len(want) {
+		t.Fatalf("appendTokenOps() got %d operations, want %d", len(ops), len(want))
+	}
+	for i, op := range ops {
+		if op.Type != want[i].opType || op.Account.Address != want[i].account || op.Amount.Value != want[i].amount ||
+			!reflect.DeepEqual(op.Amount.Currency, usdfc.Currency()) {
+			t.Errorf("appendTokenOps() operation %d got = %s %s %s, want %v", i, op.Type, op.Account.Address, op.Amount.Value, want[i])
+		}
+	}
+	if ops[0].RelatedOperations != nil || ops[3].RelatedOperations != nil {
+		t.Errorf("appendTokenOps() mints and burns got related operations")
+	}
+}
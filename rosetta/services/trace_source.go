@@ -0,0 +1,350 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coinbase/rosetta-sdk-go/types"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/filecoin-project/lotus/api"
+	filTypes "github.com/filecoin-project/lotus/chain/types"
+	"github.com/ipfs/go-cid"
+	"github.com/zondax/rosetta-filecoin-proxy/rosetta/tools"
+)
+
+// Sources of the execution traces of a tipset's messages
+const (
+	// TraceSourceAuto uses StateCompute, and falls back to the next source whenever Lotus refuses a method
+	TraceSourceAuto = "auto"
+	// TraceSourceStateCompute traces every message, implicit ones included, with all their sub-calls
+	TraceSourceStateCompute = "StateCompute"
+	// TraceSourceStateReplay replays each message included in the tipset. Implicit messages aren't traced.
+	TraceSourceStateReplay = "StateReplay"
+	// TraceSourceParentReceipts only has the top-level call of each message included in
+	// the tipset, taken from the receipts of the child tipset. Sub-calls aren't traced.
+	TraceSourceParentReceipts = "ParentReceipts"
+)
+
+// TraceSources lists the available sources, in the order followed by TraceSourceAuto
+var TraceSources = []string{TraceSourceStateCompute, TraceSourceStateReplay, TraceSourceParentReceipts}
+
+// Names of the keys in the Metadata map telling how the transactions were traced
+const (
+	// TraceSourceKey specifies the source of a block's traces, one of TraceSources.
+	TraceSourceKey = "traceSource"
+	// SubcallsTracedKey specifies whether the transfers made by sub-calls are included.
+	// It's set in blocks and transactions.
+	SubcallsTracedKey = "subcallsTraced"
+	// ImplicitMessagesTracedKey specifies whether the block includes the implicit transactions.
+	ImplicitMessagesTracedKey = "implicitMessagesTraced"
+)
+
+var errTipSetNotExecuted = errors.New("tipset not executed yet")
+
+// traceSourceSelector chooses the source of the traces. In auto mode, it starts
+// with StateCompute and falls back to the next source once Lotus refuses a method.
+// A nil selector always uses StateCompute.
+type traceSourceSelector struct {
+	auto bool
+
+	mu     sync.Mutex
+	source string
+}
+
+func newTraceSourceSelector(mode string) *traceSourceSelector {
+	if mode == TraceSourceAuto || mode == "" {
+		return &traceSourceSelector{auto: true, source: TraceSources[0]}
+	}
+	return &traceSourceSelector{source: mode}
+}
+
+func (t *traceSourceSelector) current() string {
+	if t == nil {
+		return TraceSourceStateCompute
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.source
+}
+
+// fallBack moves to the source following failed, if err shows Lotus refuses it in auto mode.
+// It returns whether there's another source to try.
+func (t *traceSourceSelector) fallBack(failed string, err error) bool {
+	if t == nil || !t.auto || !isMethodRefused(err) {
+		return false
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// Another request may have fallen back already
+	if t.source != failed {
+		return true
+	}
+	for i, source := range TraceSources[:len(TraceSources)-1] {
+		if source == failed {
+			t.source = TraceSources[i+1]
+			Logger.Warnf("Lotus refused %s, tracing blocks with %s from now on: %s", failed, t.source, err.Error())
+			return true
+		}
+	}
+
+	return false
+}
+
+// isMethodRefused returns whether err is Lotus' answer to a method it doesn't serve,
+// as public gateways do with the expensive ones
+func isMethodRefused(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "missing permission") ||
+		strings.Contains(msg, "not supported") ||
+		(strings.Contains(msg, "method") && strings.Contains(msg, "not found"))
+}
+
+// getTraces returns the execution traces of the messages of tipSet, and the source they were taken from.
+// blocksMsgs holds the messages of each block of tipSet, as returned by getBlocksMessages, and
+// headHeight the height of the chain's head as known by the caller.
+func (s *BlockAPIService) getTraces(ctx context.Context, tipSet *filTypes.TipSet,
+	blocksMsgs []*api.BlockMessages, headHeight abi.ChainEpoch) (*api.ComputeStateOutput, string, *types.Error) {
+	for {
+		source := s.traceSource.current()
+
+		var states *api.ComputeStateOutput
+		var err error
+		switch source {
+		case TraceSourceStateReplay:
+			states, err = s.replayMessages(ctx, tipSet, blocksMsgs)
+		case TraceSourceParentReceipts:
+			states, err = s.getParentReceiptsTraces(ctx, tipSet)
+		default:
+			states, err = s.getStateCompute(ctx, tipSet, headHeight)
+		}
+		if err == nil {
+			return states, source, nil
+		}
+
+		if !s.traceSource.fallBack(source, err) {
+			return nil, "", BuildLotusError(ErrUnableToGetTrace, err, true)
+		}
+	}
+}
+
+// getStateCompute returns the StateCompute output of tipSet, from tools.StateCache or
+// prefetched if enabled. Outputs of tipsets final with the chain's head at headHeight are added to tools.StateCache.
+func (s *BlockAPIService) getStateCompute(ctx context.Context, tipSet *filTypes.TipSet, headHeight abi.ChainEpoch) (*api.ComputeStateOutput, error) {
+	if tools.StateCache != nil {
+		if states, ok := tools.StateCache.Get(tipSet.Key()); ok {
+			return states, nil
+		}
+	}
+
+	var states *api.ComputeStateOutput
+	var err error
+	if s.prefetcher != nil {
+		states, err = s.prefetcher.stateCompute(ctx, tipSet)
+	} else {
+		states, err = getLotusStateCompute(ctx, &s.node, tipSet)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if tools.StateCache != nil && isFinal(tipSet, headHeight) {
+		tools.StateCache.Put(tipSet.Key(), states)
+	}
+
+	return states, nil
+}
+
+// isFinal returns whether tipSet is at least StateCacheFinalityDepth epochs below the chain's head
+// at headHeight, so it won't be reverted
+func isFinal(tipSet *filTypes.TipSet, headHeight abi.ChainEpoch) bool {
+	return headHeight-tipSet.Height() >= abi.ChainEpoch(StateCacheFinalityDepth)
+}
+
+func getLotusStateCompute(ctx context.Context, node *api.FullNode, tipSet *filTypes.TipSet) (*api.ComputeStateOutput, error) {
+	defer TimeTrack(time.Now(), "[Lotus]StateCompute")
+
+	// StateCompute includes the messages at height N-1.
+	// So, we're getting the traces of the messages created at N-1, executed at N
+	return tools.LotusCall(ctx, lotusCallTimeout(ctx), func(ctx context.Context) (*api.ComputeStateOutput, error) {
+		return (*node).StateCompute(ctx, tipSet.Height(), nil, tipSet.Key())
+	})
+}
+
+// replayMessages traces each message included in tipSet with StateReplay
+func (s *BlockAPIService) replayMessages(ctx context.Context, tipSet *filTypes.TipSet,
+	blocksMsgs []*api.BlockMessages) (*api.ComputeStateOutput, error) {
+	defer TimeTrack(time.Now(), "[Lotus]StateReplay")
+
+	states := &api.ComputeStateOutput{}
+	replayed := make(map[cid.Cid]bool)
+	for _, blockMsgs := range blocksMsgs {
+		for _, msgCid := range blockMsgs.Cids {
+			if replayed[msgCid] {
+				continue
+			}
+			replayed[msgCid] = true
+
+			trace, err := tools.LotusCall(ctx, lotusCallTimeout(ctx), func(ctx context.Context) (*api.InvocResult, error) {
+				return s.node.StateReplay(ctx, tipSet.Key(), msgCid)
+			})
+			if err != nil {
+				return nil, err
+			}
+			states.Trace = append(states.Trace, trace)
+		}
+	}
+
+	return states, nil
+}
+
+// getParentReceiptsTraces builds the top-level trace of each message executed in tipSet
+// from the receipts included in its child tipset
+func (s *BlockAPIService) getParentReceiptsTraces(ctx context.Context, tipSet *filTypes.TipSet) (*api.ComputeStateOutput, error) {
+	child, err := tools.LotusCall(ctx, lotusCallTimeout(ctx), func(ctx context.Context) (*filTypes.TipSet, error) {
+		return s.node.ChainGetTipSetAfterHeight(ctx, tipSet.Height()+1, filTypes.EmptyTSK)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if child.Parents() != tipSet.Key() {
+		return nil, fmt.Errorf("%w: no child of tipset %s found", errTipSetNotExecuted, tipSet.Key().String())
+	}
+
+	childBlock := child.Blocks()[0].Cid()
+	msgs, err := tools.LotusCall(ctx, lotusCallTimeout(ctx), func(ctx context.Context) ([]api.Message, error) {
+		return s.node.ChainGetParentMessages(ctx, childBlock)
+	})
+	if err != nil {
+		return nil, err
+	}
+	receipts, err := tools.LotusCall(ctx, lotusCallTimeout(ctx), func(ctx context.Context) ([]*filTypes.MessageReceipt, error) {
+		return s.node.ChainGetParentReceipts(ctx, childBlock)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(msgs) != len(receipts) {
+		return nil, fmt.Errorf("got %d receipts for %d messages of tipset %s", len(receipts), len(msgs), tipSet.Key().String())
+	}
+
+	// Messages included in tipSet are executed with its parent base fee
+	baseFee := tipSet.Blocks()[0].ParentBaseFee
+	states := &api.ComputeStateOutput{}
+	for i, msg := range msgs {
+		receipt := receipts[i]
+		states.Trace = append(states.Trace, &api.InvocResult{
+			MsgCid:  msg.Cid,
+			Msg:     msg.Message,
+			MsgRct:  receipt,
+			GasCost: computeGasCost(msg.Message, receipt, baseFee),
+			ExecutionTrace: filTypes.ExecutionTrace{
+				Msg: filTypes.MessageTrace{
+					From:     msg.Message.From,
+					To:       msg.Message.To,
+					Value:    msg.Message.Value,
+					Method:   msg.Message.Method,
+					Params:   msg.Message.Params,
+					GasLimit: uint64(msg.Message.GasLimit),
+				},
+				MsgRct: filTypes.ReturnTrace{
+					ExitCode: receipt.ExitCode,
+					Return:   receipt.Return,
+				},
+			},
+		})
+	}
+
+	return states, nil
+}
+
+// computeGasCost splits the gas paid by msg as Lotus does, see ComputeGasOutputs in
+// lotus/chain/vm, which can't be imported as it links the FFI. The network fee is
+// always charged, as in every network version since v12.
+func computeGasCost(msg *filTypes.Message, receipt *filTypes.MessageReceipt, baseFee abi.TokenAmount) api.MsgGasCost {
+	gasUsed := big.NewInt(receipt.GasUsed)
+
+	baseFeeToPay := baseFee
+	minerPenalty := big.Zero()
+	if big.Cmp(baseFee, msg.GasFeeCap) > 0 {
+		baseFeeToPay = msg.GasFeeCap
+		minerPenalty = big.Mul(big.Sub(baseFee, msg.GasFeeCap), gasUsed)
+	}
+	baseFeeBurn := big.Mul(baseFeeToPay, gasUsed)
+
+	minerTip := msg.GasPremium
+	if big.Cmp(big.Add(baseFeeToPay, minerTip), msg.GasFeeCap) > 0 {
+		minerTip = big.Sub(msg.GasFeeCap, baseFeeToPay)
+	}
+	minerTip = big.Mul(minerTip, big.NewInt(msg.GasLimit))
+
+	overEstimationBurn := big.Zero()
+	if gasBurned := gasOverestimationBurn(receipt.GasUsed, msg.GasLimit); gasBurned != 0 {
+		gasBurnedBig := big.NewInt(gasBurned)
+		overEstimationBurn = big.Mul(baseFeeToPay, gasBurnedBig)
+		minerPenalty = big.Add(minerPenalty, big.Mul(big.Sub(baseFee, baseFeeToPay), gasBurnedBig))
+	}
+
+	totalCost := big.Sum(baseFeeBurn, overEstimationBurn, minerTip)
+	return api.MsgGasCost{
+		Message:            msg.Cid(),
+		GasUsed:            big.NewInt(receipt.GasUsed),
+		BaseFeeBurn:        baseFeeBurn,
+		OverEstimationBurn: overEstimationBurn,
+		MinerPenalty:       minerPenalty,
+		MinerTip:           minerTip,
+		Refund:             big.Sub(big.Mul(big.NewInt(msg.GasLimit), msg.GasFeeCap), totalCost),
+		TotalCost:          totalCost,
+	}
+}
+
+// gasOverestimationBurn returns the gas burned for setting a gas limit too far above
+// gasUsed, see ComputeGasOverestimationBurn in lotus/chain/vm
+func gasOverestimationBurn(gasUsed, gasLimit int64) int64 {
+	const gasOveruseNum, gasOveruseDenom = 11, 10
+
+	if gasUsed == 0 {
+		return gasLimit
+	}
+
+	over := gasLimit - (gasOveruseNum*gasUsed)/gasOveruseDenom
+	if over < 0 {
+		return 0
+	}
+	if over > gasUsed {
+		over = gasUsed
+	}
+
+	// It overflows int64 in pathological cases
+	gasToBurn := big.Mul(big.NewInt(gasLimit-gasUsed), big.NewInt(over))
+	return big.Div(gasToBurn, big.NewInt(gasUsed)).Int64()
+}
+
+// markUntracedSubcalls flags transactions built without tracing their sub-calls
+func markUntracedSubcalls(transactions []*types.Transaction, source string) {
+	if source != TraceSourceParentReceipts {
+		return
+	}
+	for _, tx := range transactions {
+		if tx.Metadata == nil {
+			tx.Metadata = make(map[string]interface{})
+		}
+		tx.Metadata[SubcallsTracedKey] = false
+	}
+}
+
+// addTraceSourceMetadata tells in a block's metadata where its traces were taken from,
+// and which transfers may be missing
+func addTraceSourceMetadata(md map[string]interface{}, source string) {
+	md[TraceSourceKey] = source
+	md[SubcallsTracedKey] = source != TraceSourceParentReceipts
+	md[ImplicitMessagesTracedKey] = source == TraceSourceStateCompute
+}
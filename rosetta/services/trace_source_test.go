@@ -0,0 +1,142 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/crypto"
+	"github.com/filecoin-project/go-state-types/exitcode"
+	"github.com/filecoin-project/lotus/api"
+	filTypes "github.com/filecoin-project/lotus/chain/types"
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/mock"
+	mocks "github.com/zondax/rosetta-filecoin-proxy/rosetta/services/mocks"
+	"github.com/zondax/rosetta-filecoin-proxy/rosetta/tools"
+)
+
+func TestComputeGasCost(t *testing.T) {
+	mockFrom, _ := address.NewFromString("t01001")
+	mockMsg := &filTypes.Message{
+		From:       mockFrom,
+		To:         mockFrom,
+		GasLimit:   1000,
+		GasFeeCap:  abi.NewTokenAmount(150),
+		GasPremium: abi.NewTokenAmount(10),
+	}
+	mockReceipt := &filTypes.MessageReceipt{GasUsed: 800}
+
+	got := computeGasCost(mockMsg, mockReceipt, abi.NewTokenAmount(100))
+	want := api.MsgGasCost{
+		Message:            mockMsg.Cid(),
+		GasUsed:            abi.NewTokenAmount(800),
+		BaseFeeBurn:        abi.NewTokenAmount(80000),
+		OverEstimationBurn: abi.NewTokenAmount(3000),
+		MinerPenalty:       abi.NewTokenAmount(0),
+		MinerTip:           abi.NewTokenAmount(10000),
+		Refund:             abi.NewTokenAmount(57000),
+		TotalCost:          abi.NewTokenAmount(93000),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("computeGasCost() = %+v, want %+v", got, want)
+	}
+}
+
+func TestGetTracesFallsBack(t *testing.T) {
+	mockTipSet := buildMockTargetTipSet(100)
+	mockCid, _ := cid.Parse("bafkqaaa")
+	mockMiner, _ := address.NewFromString("t01000")
+	mockChild, _ := filTypes.NewTipSet([]*filTypes.BlockHeader{
+		{
+			Miner:                 mockMiner,
+			Height:                101,
+			Parents:               mockTipSet.Cids(),
+			ParentStateRoot:       mockCid,
+			Messages:              mockCid,
+			ParentMessageReceipts: mockCid,
+			BlockSig:              &crypto.Signature{Type: crypto.SigTypeBLS},
+			BLSAggregate:          &crypto.Signature{Type: crypto.SigTypeBLS},
+		},
+	})
+	mockFrom, _ := address.NewFromString("t01001")
+	mockMsg := &filTypes.Message{
+		From:       mockFrom,
+		To:         mockFrom,
+		Value:      abi.NewTokenAmount(100),
+		GasLimit:   1000,
+		GasFeeCap:  abi.NewTokenAmount(0),
+		GasPremium: abi.NewTokenAmount(0),
+	}
+	mockReceipt := &filTypes.MessageReceipt{ExitCode: exitcode.Ok, GasUsed: 800}
+
+	nodeMock := mocks.FullNode{}
+	nodeMock.On("StateCompute", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Return(nil, fmt.Errorf("missing permission to invoke 'StateCompute' (need 'read')"))
+	nodeMock.On("StateReplay", mock.Anything, mock.Anything, mock.Anything).
+		Return(nil, fmt.Errorf("method 'Filecoin.StateReplay' not found"))
+	nodeMock.On("ChainGetTipSetAfterHeight", mock.Anything, mock.Anything, mock.Anything).
+		Return(mockChild, nil)
+	nodeMock.On("ChainGetParentMessages", mock.Anything, mock.Anything).
+		Return([]api.Message{{Cid: mockMsg.Cid(), Message: mockMsg}}, nil)
+	nodeMock.On("ChainGetParentReceipts", mock.Anything, mock.Anything).
+		Return([]*filTypes.MessageReceipt{mockReceipt}, nil)
+	blocksMsgs := []*api.BlockMessages{{Cids: []cid.Cid{mockMsg.Cid()}}}
+
+	s := &BlockAPIService{node: &nodeMock, traceSource: newTraceSourceSelector(TraceSourceAuto)}
+	states, source, err := s.getTraces(context.Background(), mockTipSet, blocksMsgs, 200)
+	if err != nil {
+		t.Fatalf("getTraces() error = %v", err)
+	}
+	if source != TraceSourceParentReceipts {
+		t.Errorf("getTraces() source = %s, want %s", source, TraceSourceParentReceipts)
+	}
+	if len(states.Trace) != 1 || states.Trace[0].MsgCid != mockMsg.Cid() || states.Trace[0].ExecutionTrace.Msg.Value.Int64() != 100 {
+		t.Errorf("getTraces() got = %+v", states.Trace)
+	}
+
+	// The refused sources aren't tried again
+	_, _, err = s.getTraces(context.Background(), mockTipSet, blocksMsgs, 200)
+	if err != nil {
+		t.Fatalf("getTraces() error = %v", err)
+	}
+	nodeMock.AssertNumberOfCalls(t, "StateCompute", 1)
+	nodeMock.AssertNumberOfCalls(t, "StateReplay", 1)
+
+	// A configured source is never replaced
+	s = &BlockAPIService{node: &nodeMock, traceSource: newTraceSourceSelector(TraceSourceStateCompute)}
+	_, _, err = s.getTraces(context.Background(), mockTipSet, blocksMsgs, 200)
+	if err == nil || err.Code != ErrUnableToGetTrace.Code {
+		t.Errorf("getTraces() error = %v, want %v", err, ErrUnableToGetTrace)
+	}
+}
+
+func TestGetStateComputeCachesFinalTipSets(t *testing.T) {
+	tools.StateCache = &tools.StateComputeCache{MaxMemoryBytes: 1 << 20}
+	tools.StateCache.Open()
+	defer func() { tools.StateCache = nil }()
+
+	// ChainHead isn't mocked, the height of the head is given by the caller
+	nodeMock := mocks.FullNode{}
+	nodeMock.On("StateCompute", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Return(&api.ComputeStateOutput{}, nil)
+	s := &BlockAPIService{node: &nodeMock}
+
+	notFinal := buildMockTargetTipSet(100)
+	if _, err := s.getStateCompute(context.Background(), notFinal, abi.ChainEpoch(100+StateCacheFinalityDepth-1)); err != nil {
+		t.Fatalf("getStateCompute() error = %v", err)
+	}
+	if _, ok := tools.StateCache.Get(notFinal.Key()); ok {
+		t.Errorf("tipset %d less than %d epochs below the head was cached", notFinal.Height(), StateCacheFinalityDepth)
+	}
+
+	final := buildMockTargetTipSet(101)
+	if _, err := s.getStateCompute(context.Background(), final, abi.ChainEpoch(101+StateCacheFinalityDepth)); err != nil {
+		t.Fatalf("getStateCompute() error = %v", err)
+	}
+	if _, ok := tools.StateCache.Get(final.Key()); !ok {
+		t.Errorf("final tipset %d was not cached", final.Height())
+	}
+}
@@ -0,0 +1,63 @@
+package tools
+
+import (
+	"sort"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/ipfs/go-cid"
+)
+
+// ActorCodeRange is an epoch range [From, To] in which an actor is known to have
+// the given code. An actor's code only moves forward (e.g. placeholder -> evm, or
+// to the new code CIDs of a network upgrade) and never goes back to a previous one,
+// so two observations of the same code imply that code for every epoch in between.
+type ActorCodeRange struct {
+	Code cid.Cid
+	From abi.ChainEpoch
+	To   abi.ChainEpoch
+}
+
+// lookupActorCode returns the code valid at epoch, if any of the ranges covers it
+func lookupActorCode(ranges []ActorCodeRange, epoch abi.ChainEpoch) (cid.Cid, bool) {
+	i := sort.Search(len(ranges), func(i int) bool { return ranges[i].To >= epoch })
+	if i < len(ranges) && ranges[i].From <= epoch {
+		return ranges[i].Code, true
+	}
+
+	return cid.Cid{}, false
+}
+
+// addActorCodeObservation returns a new slice of ranges that includes the fact that the
+// actor had the given code at epoch, merging it with the neighbouring ranges when possible
+func addActorCodeObservation(ranges []ActorCodeRange, epoch abi.ChainEpoch, code cid.Cid) []ActorCodeRange {
+	if _, found := lookupActorCode(ranges, epoch); found {
+		return ranges
+	}
+
+	// Index of the first range starting after epoch
+	next := sort.Search(len(ranges), func(i int) bool { return ranges[i].From > epoch })
+	prev := next - 1
+
+	extendsPrev := prev >= 0 && ranges[prev].Code.Equals(code)
+	extendsNext := next < len(ranges) && ranges[next].Code.Equals(code)
+
+	updated := make([]ActorCodeRange, 0, len(ranges)+1)
+	switch {
+	case extendsPrev && extendsNext:
+		updated = append(updated, ranges[:prev]...)
+		updated = append(updated, ActorCodeRange{Code: code, From: ranges[prev].From, To: ranges[next].To})
+		updated = append(updated, ranges[next+1:]...)
+	case extendsPrev:
+		updated = append(updated, ranges...)
+		updated[prev].To = epoch
+	case extendsNext:
+		updated = append(updated, ranges...)
+		updated[next].From = epoch
+	default:
+		updated = append(updated, ranges[:next]...)
+		updated = append(updated, ActorCodeRange{Code: code, From: epoch, To: epoch})
+		updated = append(updated, ranges[next:]...)
+	}
+
+	return updated
+}
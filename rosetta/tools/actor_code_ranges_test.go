@@ -0,0 +1,106 @@
+package tools
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/crypto"
+	"github.com/filecoin-project/lotus/api"
+	filTypes "github.com/filecoin-project/lotus/chain/types"
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/mock"
+	"github.com/zondax/rosetta-filecoin-proxy/tests/mocks"
+	"gotest.tools/assert"
+)
+
+var (
+	placeholderCode, _ = cid.Parse("bafk2bzacedfvut2myeleyq67fljcrw4kkmn5pb5dpyozovj7jpoez5irnc3ro")
+	evmCode, _         = cid.Parse("bafk2bzaceahmzdxhqsm7cu2mexusjp6frm7r4kdesvti3etv5evfqboos2bqa")
+)
+
+func buildMockTipSet(epoch int64) *filTypes.TipSet {
+	mockCid, _ := cid.Parse("bafkqaaa")
+	mockMiner, _ := address.NewFromString("t00")
+	mockTipSet, _ := filTypes.NewTipSet([]*filTypes.BlockHeader{
+		{
+			Miner:                 mockMiner,
+			Height:                abi.ChainEpoch(epoch),
+			ParentStateRoot:       mockCid,
+			Messages:              mockCid,
+			ParentMessageReceipts: mockCid,
+			BlockSig:              &crypto.Signature{Type: crypto.SigTypeBLS},
+			BLSAggregate:          &crypto.Signature{Type: crypto.SigTypeBLS},
+		},
+	},
+	)
+	return mockTipSet
+}
+
+func TestAddActorCodeObservation(t *testing.T) {
+	var ranges []ActorCodeRange
+
+	ranges = addActorCodeObservation(ranges, 100, placeholderCode)
+	ranges = addActorCodeObservation(ranges, 300, evmCode)
+	ranges = addActorCodeObservation(ranges, 150, placeholderCode)
+	assert.Assert(t, reflect.DeepEqual(ranges, []ActorCodeRange{
+		{Code: placeholderCode, From: 100, To: 150},
+		{Code: evmCode, From: 300, To: 300},
+	}))
+
+	// Same code on both sides of a gap merges both ranges
+	ranges = addActorCodeObservation(ranges, 500, evmCode)
+	ranges = addActorCodeObservation(ranges, 400, evmCode)
+	assert.Assert(t, reflect.DeepEqual(ranges, []ActorCodeRange{
+		{Code: placeholderCode, From: 100, To: 150},
+		{Code: evmCode, From: 300, To: 500},
+	}))
+
+	ranges = addActorCodeObservation(ranges, 200, evmCode)
+	assert.Assert(t, reflect.DeepEqual(ranges, []ActorCodeRange{
+		{Code: placeholderCode, From: 100, To: 150},
+		{Code: evmCode, From: 200, To: 500},
+	}))
+
+	code, found := lookupActorCode(ranges, 120)
+	assert.Assert(t, found)
+	assert.Equal(t, code, placeholderCode)
+
+	code, found = lookupActorCode(ranges, 450)
+	assert.Assert(t, found)
+	assert.Equal(t, code, evmCode)
+
+	_, found = lookupActorCode(ranges, 170)
+	assert.Assert(t, !found)
+}
+
+func TestCacheResolvesActorCodeAtTipSet(t *testing.T) {
+	mockAddress, _ := address.NewFromString("f01234")
+	oldTipSet := buildMockTipSet(100)
+	newTipSet := buildMockTipSet(200)
+
+	nodeMock := &mocks.FullNode{}
+	nodeMock.On("StateGetActor", mock.Anything, mockAddress, oldTipSet.Key()).
+		Return(&filTypes.Actor{Code: placeholderCode}, nil).Once()
+	nodeMock.On("StateGetActor", mock.Anything, mockAddress, newTipSet.Key()).
+		Return(&filTypes.Actor{Code: evmCode}, nil).Once()
+	var node api.FullNode = nodeMock
+
+	db := &Cache{}
+	db.NewImpl(&node)
+
+	// Second round must be served from cache
+	for i := 0; i < 2; i++ {
+		code, err := db.GetActorCode(context.Background(), mockAddress, oldTipSet)
+		assert.NilError(t, err)
+		assert.Equal(t, code, placeholderCode)
+
+		code, err = db.GetActorCode(context.Background(), mockAddress, newTipSet)
+		assert.NilError(t, err)
+		assert.Equal(t, code, evmCode)
+	}
+
+	nodeMock.AssertExpectations(t)
+}
@@ -2,71 +2,159 @@ package tools
 
 import (
 	"context"
+	"errors"
 	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
 	"github.com/filecoin-project/lotus/api"
 	filTypes "github.com/filecoin-project/lotus/chain/types"
 	"github.com/ipfs/go-cid"
 	"github.com/orcaman/concurrent-map"
+	"time"
 )
 
 var ActorsDB Database
 
+// DefaultActorLookupTimeOut is the timeout of the Lotus calls looking actors up, unless set otherwise
+const DefaultActorLookupTimeOut = 60 * 4 * time.Second
+
+// ActorLookupTimeOut returns the timeout of the Lotus calls made by ActorsDB on behalf of ctx.
+// The services package sets it to follow the timeout of the endpoint being served.
+var ActorLookupTimeOut = func(ctx context.Context) time.Duration {
+	return DefaultActorLookupTimeOut
+}
+
 type Database interface {
 	NewImpl(*api.FullNode)
-	// Address-ActorCID Map
-	GetActorCode(address address.Address) (cid.Cid, error)
-	storeActorCode(address address.Address, actorCode cid.Cid)
-	// Address-ActorPubkey Map
-	GetActorPubKey(address address.Address, reverse bool) (string, error)
+	Close() error
+	// Address-ActorCID Map. Codes are resolved at the given tipSet, or at
+	// chain's head (without being cached) if tipSet is nil. Lotus is called on
+	// behalf of ctx, within ActorLookupTimeOut(ctx).
+	GetActorCode(ctx context.Context, address address.Address, tipSet *filTypes.TipSet) (cid.Cid, error)
+	storeActorCode(address address.Address, height abi.ChainEpoch, actorCode cid.Cid)
+	// Address-ActorPubkey Map. Actors Lotus reports as missing are remembered
+	// for NegativeCacheTTL and answered with ErrActorNotFound
+	GetActorPubKey(ctx context.Context, address address.Address, reverse bool) (string, error)
 	storeActorPubKey(address address.Address, pubKey string)
+	storeMissingActorPubKey(address address.Address)
 }
 
 // In-memory database
 type Cache struct {
 	cidMap    cmap.ConcurrentMap
 	pubKeyMap cmap.ConcurrentMap
+	missing   *negativeCache
 	Node      *api.FullNode
 }
 
 func (m *Cache) NewImpl(node *api.FullNode) {
 	m.cidMap = cmap.New()
 	m.pubKeyMap = cmap.New()
+	m.missing = newNegativeCache(DefaultCacheCapacity)
 	m.Node = node
 }
 
-func (m *Cache) GetActorCode(address address.Address) (cid.Cid, error) {
-	code, ok := m.cidMap.Get(address.String())
+func (m *Cache) Close() error {
+	return nil
+}
+
+func (m *Cache) GetActorCode(ctx context.Context, address address.Address, tipSet *filTypes.TipSet) (cid.Cid, error) {
+	if tipSet == nil {
+		return retrieveActorFromLotus(ctx, m.Node, address, filTypes.EmptyTSK)
+	}
+
+	if code, ok := m.lookupActorCode(address, tipSet.Height()); ok {
+		return code, nil
+	}
+
+	code, atTipSet, err := resolveActorCode(ctx, m.Node, m.missing, address, tipSet, nil)
+	if err == nil && atTipSet {
+		m.storeActorCode(address, tipSet.Height(), code)
+	}
+
+	return code, err
+}
+
+func (m *Cache) lookupActorCode(address address.Address, height abi.ChainEpoch) (cid.Cid, bool) {
+	ranges, ok := m.cidMap.Get(address.String())
 	if !ok {
-		var err error
-		code, err = m.retrieveActorFromLotus(address)
-		if err != nil {
-			return cid.Cid{}, err
-		}
-		m.storeActorCode(address, code.(cid.Cid))
+		return cid.Cid{}, false
 	}
 
-	return code.(cid.Cid), nil
+	return lookupActorCode(ranges.([]ActorCodeRange), height)
 }
 
-func (m *Cache) storeActorCode(key address.Address, value cid.Cid) {
-	m.cidMap.Set(key.String(), value)
+func (m *Cache) storeActorCode(key address.Address, height abi.ChainEpoch, value cid.Cid) {
+	m.cidMap.Upsert(key.String(), value, func(exist bool, valueInMap interface{}, newValue interface{}) interface{} {
+		var ranges []ActorCodeRange
+		if exist {
+			ranges = valueInMap.([]ActorCodeRange)
+		}
+		return addActorCodeObservation(ranges, height, newValue.(cid.Cid))
+	})
 }
 
-func (m *Cache) retrieveActorFromLotus(add address.Address) (cid.Cid, error) {
-	actor, err := (*m.Node).StateGetActor(context.Background(), add, filTypes.EmptyTSK)
+// resolveActorCode returns the code of address at tipSet, from the answers kept in missing or
+// from Lotus, and whether it was found at tipSet itself, for the caller to cache. Actors missing
+// at tipSet may have been created by one of its messages, so they're looked up at chain's head,
+// and both answers are kept in missing. Other errors are returned as they are, without caching.
+// onLotusCall, if not nil, is called before each call to Lotus.
+func resolveActorCode(ctx context.Context, node *api.FullNode, missing *negativeCache, address address.Address,
+	tipSet *filTypes.TipSet, onLotusCall func()) (cid.Cid, bool, error) {
+	key := missingActorCodeKey(address, tipSet.Height())
+	if missing.contains(key) {
+		return cid.Cid{}, false, ErrActorNotFound
+	}
+	if code, ok := missing.headCode(key); ok {
+		return code, false, nil
+	}
+
+	if onLotusCall != nil {
+		onLotusCall()
+	}
+	code, err := retrieveActorFromLotus(ctx, node, address, tipSet.Key())
+	if err == nil {
+		return code, true, nil
+	}
+	if !errors.Is(err, ErrActorNotFound) {
+		return cid.Cid{}, false, err
+	}
+
+	if onLotusCall != nil {
+		onLotusCall()
+	}
+	code, err = retrieveActorFromLotus(ctx, node, address, filTypes.EmptyTSK)
+	if errors.Is(err, ErrActorNotFound) {
+		missing.add(key)
+	} else if err == nil {
+		missing.addHeadCode(key, code)
+	}
+	return code, false, err
+}
+
+func retrieveActorFromLotus(ctx context.Context, node *api.FullNode, add address.Address, key filTypes.TipSetKey) (cid.Cid, error) {
+	actor, err := LotusCall(ctx, ActorLookupTimeOut(ctx), func(ctx context.Context) (*filTypes.Actor, error) {
+		return (*node).StateGetActor(ctx, add, key)
+	})
 	if err != nil {
-		return cid.Cid{}, err
+		return cid.Cid{}, classifyLotusError(err)
 	}
 
 	return actor.Code, nil
 }
 
-func (m *Cache) GetActorPubKey(address address.Address, reverse bool) (string, error) {
+func (m *Cache) GetActorPubKey(ctx context.Context, address address.Address, reverse bool) (string, error) {
 	pubKey, ok := m.pubKeyMap.Get(address.String())
 	if !ok {
+		if m.missing.contains(address.String()) {
+			return address.String(), ErrActorNotFound
+		}
+
 		var err error
-		pubKey, err = m.retrieveActorPubKeyFromLotus(address, reverse)
+		pubKey, err = retrieveActorPubKeyFromLotus(ctx, m.Node, address, reverse)
 		if err != nil {
+			if errors.Is(err, ErrActorNotFound) {
+				m.storeMissingActorPubKey(address)
+			}
 			return address.String(), err
 		}
 		m.storeActorPubKey(address, pubKey.(string))
@@ -79,17 +167,24 @@ func (m *Cache) storeActorPubKey(address address.Address, pubKey string) {
 	m.pubKeyMap.Set(address.String(), pubKey)
 }
 
-func (m *Cache) retrieveActorPubKeyFromLotus(add address.Address, reverse bool) (string, error) {
-	var key address.Address
-	var err error
-	if reverse {
-		key, err = (*m.Node).StateLookupID(context.Background(), add, filTypes.EmptyTSK)
-	} else {
-		key, err = (*m.Node).StateAccountKey(context.Background(), add, filTypes.EmptyTSK)
-	}
+func (m *Cache) storeMissingActorPubKey(address address.Address) {
+	m.missing.add(address.String())
+}
+
+func retrieveActorPubKeyFromLotus(ctx context.Context, node *api.FullNode, add address.Address, reverse bool) (string, error) {
+	key, err := LotusCall(ctx, ActorLookupTimeOut(ctx), func(ctx context.Context) (address.Address, error) {
+		if reverse {
+			return (*node).StateLookupID(ctx, add, filTypes.EmptyTSK)
+		}
+		return (*node).StateAccountKey(ctx, add, filTypes.EmptyTSK)
+	})
 
 	if err != nil {
-		return add.String(), nil
+		if hasNoKeyAddress(err) {
+			// Non-account actors have no key address other than their own
+			return add.String(), nil
+		}
+		return add.String(), classifyLotusError(err)
 	}
 	return key.String(), nil
 }
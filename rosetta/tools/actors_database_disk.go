@@ -0,0 +1,203 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/lotus/api"
+	filTypes "github.com/filecoin-project/lotus/chain/types"
+	"github.com/ipfs/go-cid"
+	bolt "go.etcd.io/bbolt"
+	"time"
+)
+
+var (
+	actorCodesBucket = []byte("actorCodeRanges")
+	pubKeysBucket    = []byte("pubKeys")
+)
+
+// On-disk database. Entries are kept in memory as well
+// and survive restarts of the proxy.
+type PersistentCache struct {
+	Path   string
+	memory Cache
+	db     *bolt.DB
+}
+
+func (m *PersistentCache) NewImpl(node *api.FullNode) {
+	m.memory.NewImpl(node)
+
+	db, err := bolt.Open(m.Path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		log.Errorf("could not open actors database at '%s', using in-memory cache only: %s", m.Path, err.Error())
+		return
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(actorCodesBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(pubKeysBucket)
+		return err
+	})
+	if err != nil {
+		log.Errorf("could not initialize actors database at '%s', using in-memory cache only: %s", m.Path, err.Error())
+		_ = db.Close()
+		return
+	}
+
+	m.db = db
+}
+
+func (m *PersistentCache) Close() error {
+	if m.db == nil {
+		return nil
+	}
+	return m.db.Close()
+}
+
+func (m *PersistentCache) GetActorCode(ctx context.Context, address address.Address, tipSet *filTypes.TipSet) (cid.Cid, error) {
+	if tipSet == nil {
+		return retrieveActorFromLotus(ctx, m.memory.Node, address, filTypes.EmptyTSK)
+	}
+
+	if code, ok := m.memory.lookupActorCode(address, tipSet.Height()); ok {
+		return code, nil
+	}
+
+	if ranges := m.loadActorCodeRanges(address); ranges != nil {
+		if code, ok := lookupActorCode(ranges, tipSet.Height()); ok {
+			// Every observation stored in memory is written to disk too,
+			// so the stored ranges are always a superset of the in-memory ones
+			m.memory.cidMap.Set(address.String(), ranges)
+			return code, nil
+		}
+	}
+
+	code, atTipSet, err := resolveActorCode(ctx, m.memory.Node, m.memory.missing, address, tipSet, nil)
+	if err == nil && atTipSet {
+		m.storeActorCode(address, tipSet.Height(), code)
+	}
+
+	return code, err
+}
+
+func (m *PersistentCache) storeActorCode(address address.Address, height abi.ChainEpoch, actorCode cid.Cid) {
+	m.memory.storeActorCode(address, height, actorCode)
+
+	if m.db == nil {
+		return
+	}
+
+	// Read-modify-write inside the same transaction, so concurrent observations aren't lost
+	key := []byte(address.String())
+	err := m.db.Batch(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(actorCodesBucket)
+
+		var ranges []ActorCodeRange
+		if stored := bucket.Get(key); stored != nil {
+			if err := json.Unmarshal(stored, &ranges); err != nil {
+				log.Errorf("discarding malformed actor code ranges for '%s': %s", address.String(), err.Error())
+				ranges = nil
+			}
+		}
+
+		value, err := json.Marshal(addActorCodeObservation(ranges, height, actorCode))
+		if err != nil {
+			return err
+		}
+		return bucket.Put(key, value)
+	})
+	if err != nil {
+		log.Errorf("could not write '%s' to actors database: %s", address.String(), err.Error())
+	}
+}
+
+func (m *PersistentCache) loadActorCodeRanges(address address.Address) []ActorCodeRange {
+	value := m.get(actorCodesBucket, address.String())
+	if value == nil {
+		return nil
+	}
+
+	var ranges []ActorCodeRange
+	if err := json.Unmarshal(value, &ranges); err != nil {
+		log.Errorf("could not decode stored actor code ranges for '%s': %s", address.String(), err.Error())
+		return nil
+	}
+
+	return ranges
+}
+
+func (m *PersistentCache) GetActorPubKey(ctx context.Context, address address.Address, reverse bool) (string, error) {
+	pubKey, ok := m.memory.pubKeyMap.Get(address.String())
+	if ok {
+		return pubKey.(string), nil
+	}
+
+	if value := m.get(pubKeysBucket, address.String()); value != nil {
+		m.memory.storeActorPubKey(address, string(value))
+		return string(value), nil
+	}
+
+	if m.memory.missing.contains(address.String()) {
+		return address.String(), ErrActorNotFound
+	}
+
+	retrievedKey, err := retrieveActorPubKeyFromLotus(ctx, m.memory.Node, address, reverse)
+	if err != nil {
+		if errors.Is(err, ErrActorNotFound) {
+			m.storeMissingActorPubKey(address)
+		}
+		return address.String(), err
+	}
+	m.storeActorPubKey(address, retrievedKey)
+
+	return retrievedKey, nil
+}
+
+func (m *PersistentCache) storeActorPubKey(address address.Address, pubKey string) {
+	m.memory.storeActorPubKey(address, pubKey)
+	m.put(pubKeysBucket, address.String(), []byte(pubKey))
+}
+
+func (m *PersistentCache) storeMissingActorPubKey(address address.Address) {
+	m.memory.storeMissingActorPubKey(address)
+}
+
+func (m *PersistentCache) get(bucket []byte, key string) []byte {
+	if m.db == nil {
+		return nil
+	}
+
+	var value []byte
+	err := m.db.View(func(tx *bolt.Tx) error {
+		stored := tx.Bucket(bucket).Get([]byte(key))
+		if stored != nil {
+			// Values are only valid during the transaction
+			value = append([]byte{}, stored...)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Errorf("could not read '%s' from actors database: %s", key, err.Error())
+		return nil
+	}
+
+	return value
+}
+
+func (m *PersistentCache) put(bucket []byte, key string, value []byte) {
+	if m.db == nil {
+		return
+	}
+
+	// Batch coalesces concurrent writes into a single disk transaction
+	err := m.db.Batch(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).Put([]byte(key), value)
+	})
+	if err != nil {
+		log.Errorf("could not write '%s' to actors database: %s", key, err.Error())
+	}
+}
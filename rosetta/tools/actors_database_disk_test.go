@@ -0,0 +1,61 @@
+package tools
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/lotus/api"
+	filTypes "github.com/filecoin-project/lotus/chain/types"
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/mock"
+	"github.com/zondax/rosetta-filecoin-proxy/tests/mocks"
+	"gotest.tools/assert"
+)
+
+func TestPersistentCacheSurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "actors.db")
+	mockAddress, _ := address.NewFromString("f01234")
+	mockPubKey, _ := address.NewFromString("f1d2xrzcslx7xlbbylc5c3d5lvandqw4iwl6epxba")
+	mockTipSet := buildMockTipSet(100)
+	mockCode, _ := cid.Parse("bafy2bzacebpqu5wuaddffscppacgu2cxk75skzldo45atrhwbnl4fnvb2l75m")
+
+	nodeMock := &mocks.FullNode{}
+	nodeMock.On("StateGetActor", mock.Anything, mock.Anything, mock.Anything).
+		Return(&filTypes.Actor{Code: mockCode}, nil).Once()
+	nodeMock.On("StateAccountKey", mock.Anything, mock.Anything, mock.Anything).
+		Return(mockPubKey, nil).Once()
+	var node api.FullNode = nodeMock
+
+	db := &PersistentCache{Path: path}
+	db.NewImpl(&node)
+
+	code, err := db.GetActorCode(context.Background(), mockAddress, mockTipSet)
+	assert.NilError(t, err)
+	assert.Equal(t, code, mockCode)
+
+	pubKey, err := db.GetActorPubKey(context.Background(), mockAddress, false)
+	assert.NilError(t, err)
+	assert.Equal(t, pubKey, mockPubKey.String())
+	assert.NilError(t, db.Close())
+
+	// A restarted database must answer without querying Lotus
+	emptyMock := &mocks.FullNode{}
+	var emptyNode api.FullNode = emptyMock
+
+	db = &PersistentCache{Path: path}
+	db.NewImpl(&emptyNode)
+	defer db.Close()
+
+	code, err = db.GetActorCode(context.Background(), mockAddress, mockTipSet)
+	assert.NilError(t, err)
+	assert.Equal(t, code, mockCode)
+
+	pubKey, err = db.GetActorPubKey(context.Background(), mockAddress, false)
+	assert.NilError(t, err)
+	assert.Equal(t, pubKey, mockPubKey.String())
+
+	nodeMock.AssertExpectations(t)
+	emptyMock.AssertExpectations(t)
+}
@@ -0,0 +1,159 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/lotus/api"
+	filTypes "github.com/filecoin-project/lotus/chain/types"
+	lru "github.com/hashicorp/golang-lru/v2"
+	"github.com/ipfs/go-cid"
+)
+
+// DefaultCacheCapacity is the number of entries kept by each map of a BoundedCache
+// when no Capacity is set
+const DefaultCacheCapacity = 100000
+
+// MetricsProvider is implemented by the databases that keep usage counters
+type MetricsProvider interface {
+	Metrics() CacheMetrics
+}
+
+// CacheMetrics is a snapshot of the usage counters of an actors database
+type CacheMetrics struct {
+	Hits           uint64 `json:"hits"`
+	NegativeHits   uint64 `json:"negativeHits"`
+	Misses         uint64 `json:"misses"`
+	Evictions      uint64 `json:"evictions"`
+	LotusFallbacks uint64 `json:"lotusFallbacks"`
+	CodeEntries    int    `json:"codeEntries"`
+	PubKeyEntries  int    `json:"pubKeyEntries"`
+	Capacity       int    `json:"capacity"`
+}
+
+// In-memory database holding at most Capacity entries per map,
+// evicting the least recently used ones
+type BoundedCache struct {
+	Capacity int
+	Node     *api.FullNode
+
+	cidMap    *lru.Cache[string, []ActorCodeRange]
+	pubKeyMap *lru.Cache[string, string]
+	missing   *negativeCache
+	// Serializes the read-modify-write of actor code ranges
+	cidMapLock sync.Mutex
+
+	hits           atomic.Uint64
+	negativeHits   atomic.Uint64
+	misses         atomic.Uint64
+	evictions      atomic.Uint64
+	lotusFallbacks atomic.Uint64
+}
+
+func (m *BoundedCache) NewImpl(node *api.FullNode) {
+	if m.Capacity <= 0 {
+		m.Capacity = DefaultCacheCapacity
+	}
+
+	// Errors are only returned for non-positive sizes
+	m.cidMap, _ = lru.NewWithEvict[string, []ActorCodeRange](m.Capacity, func(string, []ActorCodeRange) {
+		m.evictions.Add(1)
+	})
+	m.pubKeyMap, _ = lru.NewWithEvict[string, string](m.Capacity, func(string, string) {
+		m.evictions.Add(1)
+	})
+	m.missing = newNegativeCache(m.Capacity)
+	m.Node = node
+}
+
+func (m *BoundedCache) Close() error {
+	return nil
+}
+
+func (m *BoundedCache) Metrics() CacheMetrics {
+	return CacheMetrics{
+		Hits:           m.hits.Load(),
+		NegativeHits:   m.negativeHits.Load(),
+		Misses:         m.misses.Load(),
+		Evictions:      m.evictions.Load(),
+		LotusFallbacks: m.lotusFallbacks.Load(),
+		CodeEntries:    m.cidMap.Len(),
+		PubKeyEntries:  m.pubKeyMap.Len(),
+		Capacity:       m.Capacity,
+	}
+}
+
+func (m *BoundedCache) GetActorCode(ctx context.Context, address address.Address, tipSet *filTypes.TipSet) (cid.Cid, error) {
+	if tipSet == nil {
+		m.lotusFallbacks.Add(1)
+		return retrieveActorFromLotus(ctx, m.Node, address, filTypes.EmptyTSK)
+	}
+
+	if ranges, ok := m.cidMap.Get(address.String()); ok {
+		if code, found := lookupActorCode(ranges, tipSet.Height()); found {
+			m.hits.Add(1)
+			return code, nil
+		}
+	}
+
+	lotusCalls := 0
+	code, atTipSet, err := resolveActorCode(ctx, m.Node, m.missing, address, tipSet, func() {
+		if lotusCalls == 0 {
+			m.misses.Add(1)
+		}
+		lotusCalls++
+		m.lotusFallbacks.Add(1)
+	})
+	if lotusCalls == 0 {
+		m.negativeHits.Add(1)
+	}
+	if err == nil && atTipSet {
+		m.storeActorCode(address, tipSet.Height(), code)
+	}
+
+	return code, err
+}
+
+func (m *BoundedCache) storeActorCode(address address.Address, height abi.ChainEpoch, actorCode cid.Cid) {
+	m.cidMapLock.Lock()
+	defer m.cidMapLock.Unlock()
+
+	ranges, _ := m.cidMap.Peek(address.String())
+	m.cidMap.Add(address.String(), addActorCodeObservation(ranges, height, actorCode))
+}
+
+func (m *BoundedCache) GetActorPubKey(ctx context.Context, address address.Address, reverse bool) (string, error) {
+	if pubKey, ok := m.pubKeyMap.Get(address.String()); ok {
+		m.hits.Add(1)
+		return pubKey, nil
+	}
+	if m.missing.contains(address.String()) {
+		m.negativeHits.Add(1)
+		return address.String(), ErrActorNotFound
+	}
+	m.misses.Add(1)
+
+	m.lotusFallbacks.Add(1)
+	pubKey, err := retrieveActorPubKeyFromLotus(ctx, m.Node, address, reverse)
+	if err != nil {
+		if errors.Is(err, ErrActorNotFound) {
+			m.storeMissingActorPubKey(address)
+		}
+		return address.String(), err
+	}
+	m.storeActorPubKey(address, pubKey)
+
+	return pubKey, nil
+}
+
+func (m *BoundedCache) storeActorPubKey(address address.Address, pubKey string) {
+	m.pubKeyMap.Add(address.String(), pubKey)
+}
+
+func (m *BoundedCache) storeMissingActorPubKey(address address.Address) {
+	m.missing.add(address.String())
+}
@@ -0,0 +1,45 @@
+package tools
+
+import (
+	"context"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/lotus/api"
+	filTypes "github.com/filecoin-project/lotus/chain/types"
+	"github.com/stretchr/testify/mock"
+	"github.com/zondax/rosetta-filecoin-proxy/tests/mocks"
+	"gotest.tools/assert"
+)
+
+func TestBoundedCacheEvictsAndCounts(t *testing.T) {
+	mockAddress1, _ := address.NewFromString("f01234")
+	mockAddress2, _ := address.NewFromString("f05678")
+	mockTipSet := buildMockTipSet(100)
+
+	nodeMock := &mocks.FullNode{}
+	nodeMock.On("StateGetActor", mock.Anything, mock.Anything, mock.Anything).
+		Return(&filTypes.Actor{Code: evmCode}, nil)
+	var node api.FullNode = nodeMock
+
+	db := &BoundedCache{Capacity: 1}
+	db.NewImpl(&node)
+
+	_, err := db.GetActorCode(context.Background(), mockAddress1, mockTipSet)
+	assert.NilError(t, err)
+	_, err = db.GetActorCode(context.Background(), mockAddress1, mockTipSet)
+	assert.NilError(t, err)
+	// Evicts mockAddress1
+	_, err = db.GetActorCode(context.Background(), mockAddress2, mockTipSet)
+	assert.NilError(t, err)
+	_, err = db.GetActorCode(context.Background(), mockAddress1, mockTipSet)
+	assert.NilError(t, err)
+
+	metrics := db.Metrics()
+	assert.Equal(t, metrics.Hits, uint64(1))
+	assert.Equal(t, metrics.Misses, uint64(3))
+	assert.Equal(t, metrics.LotusFallbacks, uint64(3))
+	assert.Equal(t, metrics.Evictions, uint64(2))
+	assert.Equal(t, metrics.CodeEntries, 1)
+	assert.Equal(t, metrics.Capacity, 1)
+}
@@ -1,7 +1,8 @@
 package tools
 
 import (
-	"fmt"
+	"context"
+	"errors"
 	"time"
 
 	logging "github.com/ipfs/go-log"
@@ -9,46 +10,25 @@ import (
 
 var log = logging.Logger("RPC_Lotus")
 
-type LotusRPCWrapper func()
-
-// WrapWithTimeout executes lotusFunc but return an error after the `timeout`
-func WrapWithTimeout(lotusFunc LotusRPCWrapper, timeout time.Duration) error {
-	ch := make(chan bool, 1)
-	defer func() {
-		if ch != nil {
-			close(ch)
-		}
-		ch = nil
-	}()
-
-	go func() {
-		lotusFunc()
-		if ch != nil {
-			ch <- true
-		}
-	}()
-
-	timer := time.NewTimer(timeout)
-	defer timer.Stop()
-
-	select {
-	case <-ch:
-		{
-			log.Debug("received answer from Lotus")
-			if ch != nil {
-				close(ch)
-			}
-			ch = nil
-			return nil
-		}
-	case <-timer.C:
-		{
-			log.Error("call to Lotus RPC timed out!")
-			if ch != nil {
-				close(ch)
-			}
-			ch = nil
-			return fmt.Errorf("call to Lotus RPC timed out!")
-		}
+// ErrCallTimedOut is returned by LotusCall when Lotus doesn't answer before the timeout
+var ErrCallTimedOut = errors.New("call to Lotus RPC timed out")
+
+// LotusRPCCall is a call to the Lotus RPC made with the given context
+type LotusRPCCall[T any] func(ctx context.Context) (T, error)
+
+// LotusCall executes lotusFunc with a context derived from ctx that expires after `timeout`.
+// The RPC client cancels the request as soon as that context is done, either because the
+// timeout expired (ErrCallTimedOut is returned) or because ctx was cancelled (e.g. the client
+// of the proxy disconnected), so no call is left running in the background.
+func LotusCall[T any](ctx context.Context, timeout time.Duration, lotusFunc LotusRPCCall[T]) (T, error) {
+	callCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	result, err := lotusFunc(callCtx)
+	if err != nil && ctx.Err() == nil && errors.Is(callCtx.Err(), context.DeadlineExceeded) {
+		log.Error("call to Lotus RPC timed out!")
+		return result, ErrCallTimedOut
 	}
+
+	return result, err
 }
@@ -1,43 +1,47 @@
 package tools
 
 import (
+	"context"
+	"errors"
 	"gotest.tools/assert"
 	"testing"
 	"time"
 )
 
-func TestTimeout(t *testing.T) {
-	// wrap the implementation and use variable capture
-	impl := func() {
-		time.Sleep(2 * time.Second)
+// sleepingCall behaves as the RPC client does, returning as soon as ctx is done
+func sleepingCall(d time.Duration, result string) LotusRPCCall[string] {
+	return func(ctx context.Context) (string, error) {
+		select {
+		case <-time.After(d):
+			return result, nil
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
 	}
+}
 
+func TestTimeout(t *testing.T) {
 	// Measure time
 	start := time.Now()
 
-	// Now run the implementation wrapped with a timeout
-	err := WrapWithTimeout(impl, 1*time.Second)
+	// Now run the implementation with a timeout
+	_, err := LotusCall(context.Background(), 1*time.Second, sleepingCall(2*time.Second, ""))
 
 	// Calculate Elapsed time
 	elapsed := time.Since(start)
 
-	assert.Error(t, err, "call to Lotus RPC timed out!")
+	assert.Assert(t, errors.Is(err, ErrCallTimedOut))
 
 	assert.Assert(t, elapsed.Milliseconds() < 1100)
 	assert.Assert(t, elapsed.Milliseconds() > 900)
 }
 
 func TestDoNotTimeout(t *testing.T) {
-	// wrap the implementation and use variable capture
-	impl := func() {
-		time.Sleep(2 * time.Second)
-	}
-
 	// Measure time
 	start := time.Now()
 
-	// Now run the implementation wrapped with a timeout
-	err := WrapWithTimeout(impl, 3*time.Second)
+	// Now run the implementation with a timeout
+	_, err := LotusCall(context.Background(), 3*time.Second, sleepingCall(2*time.Second, ""))
 
 	// Calculate Elapsed time
 	elapsed := time.Since(start)
@@ -48,15 +52,22 @@ func TestDoNotTimeout(t *testing.T) {
 	assert.Assert(t, elapsed.Milliseconds() > 1900)
 }
 
-func TestCopyVariable(t *testing.T) {
-	// wrap the implementation and use variable capture
-	var someVar string
-	impl := func() {
-		time.Sleep(1 * time.Second)
-		someVar = "Copied"
-	}
-
-	err := WrapWithTimeout(impl, 3*time.Second)
+func TestReturnValue(t *testing.T) {
+	result, err := LotusCall(context.Background(), 3*time.Second, sleepingCall(1*time.Second, "Copied"))
 	assert.NilError(t, err)
-	assert.Equal(t, someVar, "Copied")
+	assert.Equal(t, result, "Copied")
+}
+
+func TestCancelledByCaller(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := LotusCall(ctx, 3*time.Second, sleepingCall(2*time.Second, ""))
+	elapsed := time.Since(start)
+
+	// The caller's deadline isn't reported as a Lotus timeout
+	assert.Assert(t, errors.Is(err, context.DeadlineExceeded))
+	assert.Assert(t, !errors.Is(err, ErrCallTimedOut))
+	assert.Assert(t, elapsed.Milliseconds() < 600)
 }
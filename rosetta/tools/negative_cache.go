@@ -0,0 +1,95 @@
+package tools
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/hashicorp/golang-lru/v2/expirable"
+	"github.com/ipfs/go-cid"
+)
+
+// DefaultNegativeCacheTTL is the default time a "not found" answer from Lotus is kept
+const DefaultNegativeCacheTTL = 10 * time.Minute
+
+// NegativeCacheTTL is the time a "not found" answer from Lotus is kept before asking again
+var NegativeCacheTTL = DefaultNegativeCacheTTL
+
+// ErrActorNotFound is returned when Lotus reports that an actor doesn't exist,
+// as opposed to a failure of the call itself
+var ErrActorNotFound = errors.New("actor not found")
+
+// Lotus errors (as received over RPC) meaning the actor doesn't exist
+var notFoundErrMessages = []string{
+	"actor not found",
+	"failed to find actor",
+	"resolution lookup failed",
+	"cannot resolve actor address to key address",
+}
+
+// Lotus error meaning the actor exists but has no key address (it isn't an account)
+const noKeyAddressErrMessage = "failed to get account actor state"
+
+func isNotFoundError(err error) bool {
+	for _, msg := range notFoundErrMessages {
+		if strings.Contains(err.Error(), msg) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasNoKeyAddress(err error) bool {
+	return strings.Contains(err.Error(), noKeyAddressErrMessage)
+}
+
+// classifyLotusError wraps err with ErrActorNotFound if it reports a missing actor.
+// Any other error is considered transient.
+func classifyLotusError(err error) error {
+	if isNotFoundError(err) {
+		return fmt.Errorf("%w: %s", ErrActorNotFound, err.Error())
+	}
+	return err
+}
+
+// negativeCache keeps "not found" answers for NegativeCacheTTL, along with the codes found
+// at chain's head for actors missing at a tipSet, as the head moves on
+type negativeCache struct {
+	entries   *expirable.LRU[string, struct{}]
+	headCodes *expirable.LRU[string, cid.Cid]
+}
+
+func newNegativeCache(size int) *negativeCache {
+	return &negativeCache{
+		entries:   expirable.NewLRU[string, struct{}](size, nil, NegativeCacheTTL),
+		headCodes: expirable.NewLRU[string, cid.Cid](size, nil, NegativeCacheTTL),
+	}
+}
+
+func (n *negativeCache) contains(key string) bool {
+	_, ok := n.entries.Get(key)
+	return ok
+}
+
+func (n *negativeCache) add(key string) {
+	n.entries.Add(key, struct{}{})
+}
+
+// headCode returns the code found at chain's head for an actor missing at a tipSet, keyed by
+// missingActorCodeKey
+func (n *negativeCache) headCode(key string) (cid.Cid, bool) {
+	return n.headCodes.Get(key)
+}
+
+func (n *negativeCache) addHeadCode(key string, code cid.Cid) {
+	n.headCodes.Add(key, code)
+}
+
+// Actors can exist at some heights and not at others (e.g. deleted actors),
+// so missing codes are keyed by height as well
+func missingActorCodeKey(address address.Address, height abi.ChainEpoch) string {
+	return fmt.Sprintf("%s@%d", address.String(), height)
+}
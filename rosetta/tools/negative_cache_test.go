@@ -0,0 +1,163 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/lotus/api"
+	filTypes "github.com/filecoin-project/lotus/chain/types"
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/mock"
+	"github.com/zondax/rosetta-filecoin-proxy/tests/mocks"
+	"gotest.tools/assert"
+)
+
+func TestMissingActorIsCachedUntilExpired(t *testing.T) {
+	NegativeCacheTTL = 100 * time.Millisecond
+	defer func() { NegativeCacheTTL = DefaultNegativeCacheTTL }()
+
+	mockAddress, _ := address.NewFromString("f1d2xrzcslx7xlbbylc5c3d5lvandqw4iwl6epxba")
+	mockTipSet := buildMockTipSet(100)
+
+	nodeMock := &mocks.FullNode{}
+	nodeMock.On("StateAccountKey", mock.Anything, mock.Anything, mock.Anything).
+		Return(address.Undef, errors.New("resolution lookup failed (f1d2xrzcslx7xlbbylc5c3d5lvandqw4iwl6epxba): actor not found"))
+	nodeMock.On("StateGetActor", mock.Anything, mock.Anything, mock.Anything).
+		Return(nil, errors.New("failed to find actor: f1d2xrzcslx7xlbbylc5c3d5lvandqw4iwl6epxba"))
+	var node api.FullNode = nodeMock
+
+	for _, db := range []Database{&Cache{}, &BoundedCache{}} {
+		nodeMock.Calls = nil
+		db.NewImpl(&node)
+
+		for i := 0; i < 3; i++ {
+			pubKey, err := db.GetActorPubKey(context.Background(), mockAddress, false)
+			assert.Assert(t, errors.Is(err, ErrActorNotFound))
+			assert.Equal(t, pubKey, mockAddress.String())
+
+			_, err = db.GetActorCode(context.Background(), mockAddress, mockTipSet)
+			assert.Assert(t, errors.Is(err, ErrActorNotFound))
+		}
+		nodeMock.AssertNumberOfCalls(t, "StateAccountKey", 1)
+		// Looked up at the tipSet and at chain's head
+		nodeMock.AssertNumberOfCalls(t, "StateGetActor", 2)
+
+		time.Sleep(2 * NegativeCacheTTL)
+
+		_, err := db.GetActorPubKey(context.Background(), mockAddress, false)
+		assert.Assert(t, errors.Is(err, ErrActorNotFound))
+		nodeMock.AssertNumberOfCalls(t, "StateAccountKey", 2)
+	}
+}
+
+func TestActorFoundAtHeadIsCached(t *testing.T) {
+	mockAddress, _ := address.NewFromString("f01234")
+	mockTipSet := buildMockTipSet(100)
+	mockCode, _ := cid.Parse("bafk2bzacebalad3f72wyk7qyilvfjijcwubdspytnyzlrhvn73254gqis44rq")
+
+	// Created by a message of mockTipSet, so it only exists at chain's head
+	nodeMock := &mocks.FullNode{}
+	nodeMock.On("StateGetActor", mock.Anything, mock.Anything, filTypes.EmptyTSK).
+		Return(&filTypes.Actor{Code: mockCode}, nil)
+	nodeMock.On("StateGetActor", mock.Anything, mock.Anything, mock.Anything).
+		Return(nil, errors.New("failed to find actor: f01234"))
+	var node api.FullNode = nodeMock
+
+	for _, db := range []Database{&Cache{}, &BoundedCache{}} {
+		nodeMock.Calls = nil
+		db.NewImpl(&node)
+
+		for i := 0; i < 3; i++ {
+			code, err := db.GetActorCode(context.Background(), mockAddress, mockTipSet)
+			assert.NilError(t, err)
+			assert.Equal(t, code, mockCode)
+		}
+		// Looked up at the tipSet and at chain's head
+		nodeMock.AssertNumberOfCalls(t, "StateGetActor", 2)
+	}
+}
+
+func TestLotusErrorIsNotCached(t *testing.T) {
+	mockAddress, _ := address.NewFromString("f01234")
+	mockTipSet := buildMockTipSet(100)
+	mockCode, _ := cid.Parse("bafk2bzacebalad3f72wyk7qyilvfjijcwubdspytnyzlrhvn73254gqis44rq")
+
+	// Failing calls aren't mistaken for missing actors, so the actor found at chain's head isn't used
+	nodeMock := &mocks.FullNode{}
+	nodeMock.On("StateLookupID", mock.Anything, mock.Anything, mock.Anything).
+		Return(address.Undef, errors.New("RPC client error: sendRequest failed: connection refused"))
+	nodeMock.On("StateGetActor", mock.Anything, mock.Anything, filTypes.EmptyTSK).
+		Return(&filTypes.Actor{Code: mockCode}, nil)
+	nodeMock.On("StateGetActor", mock.Anything, mock.Anything, mock.Anything).
+		Return(nil, errors.New("RPC client error: sendRequest failed: connection refused"))
+	var node api.FullNode = nodeMock
+
+	for _, db := range []Database{&Cache{}, &BoundedCache{}, &PersistentCache{Path: filepath.Join(t.TempDir(), "actors.db")}} {
+		nodeMock.Calls = nil
+		db.NewImpl(&node)
+
+		for i := 0; i < 2; i++ {
+			pubKey, err := db.GetActorPubKey(context.Background(), mockAddress, true)
+			assert.Assert(t, err != nil)
+			assert.Assert(t, !errors.Is(err, ErrActorNotFound))
+			assert.Equal(t, pubKey, mockAddress.String())
+
+			_, err = db.GetActorCode(context.Background(), mockAddress, mockTipSet)
+			assert.Assert(t, err != nil)
+			assert.Assert(t, !errors.Is(err, ErrActorNotFound))
+		}
+		nodeMock.AssertNumberOfCalls(t, "StateLookupID", 2)
+		nodeMock.AssertNumberOfCalls(t, "StateGetActor", 2)
+		assert.NilError(t, db.Close())
+	}
+}
+
+func TestCancelledLookupIsAborted(t *testing.T) {
+	mockAddress, _ := address.NewFromString("f01234")
+	mockTipSet := buildMockTipSet(100)
+
+	// Lotus doesn't answer until the call is cancelled
+	nodeMock := &mocks.FullNode{}
+	nodeMock.On("StateGetActor", mock.Anything, mock.Anything, mock.Anything).
+		Return(func(ctx context.Context, _ address.Address, _ filTypes.TipSetKey) (*filTypes.Actor, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}, nil)
+	var node api.FullNode = nodeMock
+
+	for _, db := range []Database{&Cache{}, &BoundedCache{}} {
+		nodeMock.Calls = nil
+		db.NewImpl(&node)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(50*time.Millisecond, cancel)
+
+		_, err := db.GetActorCode(ctx, mockAddress, mockTipSet)
+		assert.Assert(t, errors.Is(err, context.Canceled))
+		// Not looked up at chain's head once cancelled
+		nodeMock.AssertNumberOfCalls(t, "StateGetActor", 1)
+	}
+}
+
+func TestNonAccountActorResolvesToItself(t *testing.T) {
+	mockAddress, _ := address.NewFromString("f01234")
+
+	nodeMock := &mocks.FullNode{}
+	nodeMock.On("StateAccountKey", mock.Anything, mock.Anything, mock.Anything).
+		Return(address.Undef, errors.New("failed to get account actor state for f01234"))
+	var node api.FullNode = nodeMock
+
+	db := &Cache{}
+	db.NewImpl(&node)
+
+	for i := 0; i < 2; i++ {
+		pubKey, err := db.GetActorPubKey(context.Background(), mockAddress, false)
+		assert.NilError(t, err)
+		assert.Equal(t, pubKey, mockAddress.String())
+	}
+	nodeMock.AssertNumberOfCalls(t, "StateAccountKey", 1)
+}
@@ -0,0 +1,219 @@
+package tools
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/filecoin-project/lotus/api"
+	filTypes "github.com/filecoin-project/lotus/chain/types"
+	"github.com/hashicorp/golang-lru/v2/simplelru"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	DefaultStateCacheMemoryMB = 256
+	DefaultStateCacheDiskMB   = 10 * 1024
+)
+
+var (
+	statesBucket      = []byte("states")
+	statesOrderBucket = []byte("statesOrder")
+)
+
+// StateCache is set on startup when caching StateCompute outputs is enabled
+var StateCache *StateComputeCache
+
+// StateComputeCache keeps the StateCompute output of tipsets, by tipset key, so each
+// tipset is computed only once. Outputs are kept in memory up to MaxMemoryBytes, and the
+// least recently used ones are spilled to the on-disk database at SpillPath, if set,
+// where the oldest ones are dropped past MaxDiskBytes.
+type StateComputeCache struct {
+	MaxMemoryBytes int64
+	SpillPath      string
+	MaxDiskBytes   int64
+
+	mu          sync.Mutex
+	memory      *simplelru.LRU[filTypes.TipSetKey, *api.ComputeStateOutput]
+	memoryBytes int64
+	sizes       map[filTypes.TipSetKey]int64
+	db          *bolt.DB
+	diskBytes   int64
+}
+
+func (c *StateComputeCache) Open() {
+	c.memory, _ = simplelru.NewLRU[filTypes.TipSetKey, *api.ComputeStateOutput](math.MaxInt, c.spill)
+	c.sizes = make(map[filTypes.TipSetKey]int64)
+
+	if c.SpillPath == "" {
+		return
+	}
+
+	db, err := bolt.Open(c.SpillPath, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		log.Errorf("could not open states database at '%s', keeping states in memory only: %s", c.SpillPath, err.Error())
+		return
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		states, err := tx.CreateBucketIfNotExists(statesBucket)
+		if err != nil {
+			return err
+		}
+		if _, err = tx.CreateBucketIfNotExists(statesOrderBucket); err != nil {
+			return err
+		}
+
+		c.diskBytes = 0
+		return states.ForEach(func(_, value []byte) error {
+			c.diskBytes += int64(len(value))
+			return nil
+		})
+	})
+	if err != nil {
+		log.Errorf("could not initialize states database at '%s', keeping states in memory only: %s", c.SpillPath, err.Error())
+		_ = db.Close()
+		return
+	}
+
+	c.db = db
+}
+
+func (c *StateComputeCache) Close() error {
+	if c.db == nil {
+		return nil
+	}
+	return c.db.Close()
+}
+
+// Get returns the StateCompute output of the tipset with the given key, if cached
+func (c *StateComputeCache) Get(key filTypes.TipSetKey) (*api.ComputeStateOutput, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if states, ok := c.memory.Get(key); ok {
+		return states, true
+	}
+
+	if c.db == nil {
+		return nil, false
+	}
+
+	var stored []byte
+	_ = c.db.View(func(tx *bolt.Tx) error {
+		if value := tx.Bucket(statesBucket).Get(key.Bytes()); value != nil {
+			stored = append([]byte{}, value...)
+		}
+		return nil
+	})
+	if stored == nil {
+		return nil, false
+	}
+
+	var states api.ComputeStateOutput
+	if err := json.Unmarshal(stored, &states); err != nil {
+		log.Errorf("discarding malformed states of tipset %s: %s", key.String(), err.Error())
+		return nil, false
+	}
+
+	return &states, true
+}
+
+// Put caches the StateCompute output of the tipset with the given key
+func (c *StateComputeCache) Put(key filTypes.TipSetKey, states *api.ComputeStateOutput) {
+	// The size of the encoded output is a good estimate of the memory it takes
+	encoded, err := json.Marshal(states)
+	if err != nil {
+		log.Errorf("could not cache states of tipset %s: %s", key.String(), err.Error())
+		return
+	}
+	size := int64(len(encoded))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.memory.Contains(key) {
+		return
+	}
+	if size > c.MaxMemoryBytes {
+		c.store(key, encoded)
+		return
+	}
+
+	c.memory.Add(key, states)
+	c.sizes[key] = size
+	c.memoryBytes += size
+	for c.memoryBytes > c.MaxMemoryBytes {
+		c.memory.RemoveOldest()
+	}
+}
+
+// spill is called by the memory cache when an entry is evicted
+func (c *StateComputeCache) spill(key filTypes.TipSetKey, states *api.ComputeStateOutput) {
+	c.memoryBytes -= c.sizes[key]
+	delete(c.sizes, key)
+
+	if c.db == nil {
+		return
+	}
+
+	encoded, err := json.Marshal(states)
+	if err != nil {
+		log.Errorf("could not spill states of tipset %s: %s", key.String(), err.Error())
+		return
+	}
+	c.store(key, encoded)
+}
+
+// store writes the encoded states to disk, dropping the oldest ones above MaxDiskBytes
+func (c *StateComputeCache) store(key filTypes.TipSetKey, encoded []byte) {
+	if c.db == nil || int64(len(encoded)) > c.MaxDiskBytes {
+		return
+	}
+
+	diskBytes := c.diskBytes
+	err := c.db.Update(func(tx *bolt.Tx) error {
+		states := tx.Bucket(statesBucket)
+		order := tx.Bucket(statesOrderBucket)
+
+		if previous := states.Get(key.Bytes()); previous != nil {
+			return nil
+		}
+
+		seq, err := order.NextSequence()
+		if err != nil {
+			return err
+		}
+		seqKey := make([]byte, 8)
+		binary.BigEndian.PutUint64(seqKey, seq)
+		if err = order.Put(seqKey, key.Bytes()); err != nil {
+			return err
+		}
+		if err = states.Put(key.Bytes(), encoded); err != nil {
+			return err
+		}
+		diskBytes += int64(len(encoded))
+
+		for diskBytes > c.MaxDiskBytes {
+			oldestSeq, oldestKey := order.Cursor().First()
+			if oldestSeq == nil {
+				break
+			}
+			diskBytes -= int64(len(states.Get(oldestKey)))
+			if err = states.Delete(oldestKey); err != nil {
+				return err
+			}
+			if err = order.Delete(oldestSeq); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Errorf("could not spill states of tipset %s: %s", key.String(), err.Error())
+		return
+	}
+	c.diskBytes = diskBytes
+}
@@ -0,0 +1,71 @@
+package tools
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/lotus/api"
+	filTypes "github.com/filecoin-project/lotus/chain/types"
+	"gotest.tools/assert"
+)
+
+func buildMockStates(value int64) *api.ComputeStateOutput {
+	from, _ := address.NewIDAddress(1001)
+	to, _ := address.NewIDAddress(1002)
+	msg := &filTypes.Message{From: from, To: to, Value: abi.NewTokenAmount(value)}
+	return &api.ComputeStateOutput{
+		Trace: []*api.InvocResult{{MsgCid: msg.Cid(), Msg: msg}},
+	}
+}
+
+func TestStateCacheSpillsToDisk(t *testing.T) {
+	encoded, err := json.Marshal(buildMockStates(100))
+	assert.NilError(t, err)
+	size := int64(len(encoded))
+
+	// One output fits in memory and two on disk
+	cache := &StateComputeCache{
+		MaxMemoryBytes: size,
+		SpillPath:      filepath.Join(t.TempDir(), "states.db"),
+		MaxDiskBytes:   2 * size,
+	}
+	cache.Open()
+	defer cache.Close()
+
+	var keys []filTypes.TipSetKey
+	for height := int64(100); height < 104; height++ {
+		key := buildMockTipSet(height).Key()
+		keys = append(keys, key)
+		cache.Put(key, buildMockStates(height))
+	}
+
+	_, ok := cache.Get(keys[0])
+	assert.Assert(t, !ok, "the oldest spilled output must be dropped")
+	for i, key := range keys[1:] {
+		states, ok := cache.Get(key)
+		assert.Assert(t, ok)
+		assert.Equal(t, states.Trace[0].MsgCid, buildMockStates(int64(101 + i)).Trace[0].MsgCid)
+	}
+}
+
+func TestStateCacheMemoryOnly(t *testing.T) {
+	encoded, err := json.Marshal(buildMockStates(100))
+	assert.NilError(t, err)
+
+	cache := &StateComputeCache{MaxMemoryBytes: int64(len(encoded))}
+	cache.Open()
+	defer cache.Close()
+
+	first := buildMockTipSet(100).Key()
+	second := buildMockTipSet(101).Key()
+	cache.Put(first, buildMockStates(100))
+	cache.Put(second, buildMockStates(101))
+
+	_, ok := cache.Get(first)
+	assert.Assert(t, !ok, "evicted outputs are dropped without a spill path")
+	_, ok = cache.Get(second)
+	assert.Assert(t, ok)
+}